@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aetheria/blockchain/pkg/blockchain"
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// listFlag collects every value of a repeatable flag
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runGenesisCommand handles `aetheria genesis <init|hash>`
+func runGenesisCommand(args []string) {
+	if len(args) == 0 {
+		genesisUsage()
+	}
+
+	fs := flag.NewFlagSet("genesis "+args[0], flag.ExitOnError)
+	file := fs.String("genesis", "genesis.json", "Genesis file")
+
+	switch args[0] {
+	case "init":
+		chainID := fs.String("chain-id", "aetheria-local", "Chain ID")
+		genesisTime := fs.Int64("time", time.Now().Unix(), "Genesis time (unix seconds)")
+		var allocs, validators listFlag
+		fs.Var(&allocs, "alloc", "Balance allocation as address=amount (repeatable)")
+		fs.Var(&validators, "validator", "Genesis validator as publickey=stake (repeatable)")
+		params := paramFlags(fs)
+		fs.Parse(args[1:])
+
+		genesis := blockchain.NewGenesis(*chainID, *genesisTime)
+		genesis.Params = *params
+		for _, alloc := range allocs {
+			address, amount, err := splitAmount(alloc)
+			if err != nil {
+				log.Fatalf("Invalid allocation %q: %v", alloc, err)
+			}
+			genesis.Allocations = append(genesis.Allocations, blockchain.GenesisAllocation{Address: address, Balance: amount})
+		}
+		for _, v := range validators {
+			publicKey, stake, err := splitAmount(v)
+			if err != nil {
+				log.Fatalf("Invalid validator %q: %v", v, err)
+			}
+			key, err := crypto.PublicKeyFromHex(publicKey)
+			if err != nil {
+				log.Fatalf("Invalid validator %q: %v", v, err)
+			}
+			genesis.Validators = append(genesis.Validators, blockchain.GenesisValidator{
+				Address:   crypto.PublicKeyToAddress(key),
+				PublicKey: publicKey,
+				Stake:     stake,
+			})
+		}
+		if err := genesis.Validate(); err != nil {
+			log.Fatalf("Invalid genesis: %v", err)
+		}
+
+		if _, err := os.Stat(*file); err == nil {
+			log.Fatalf("%s already exists", *file)
+		}
+		if err := genesis.Save(*file); err != nil {
+			log.Fatalf("Failed to save genesis: %v", err)
+		}
+		fmt.Printf("Wrote %s (chain %s, genesis hash %s)\n", *file, genesis.ChainID, genesis.Hash())
+
+	case "hash":
+		fs.Parse(args[1:])
+		genesis, err := blockchain.LoadGenesis(*file)
+		if err != nil {
+			log.Fatalf("Failed to load genesis: %v", err)
+		}
+		fmt.Printf("chain id      %s\n", genesis.ChainID)
+		fmt.Printf("genesis hash  %s\n", genesis.Hash())
+		fmt.Printf("genesis block %s\n", genesis.Block(genesis.State()).Hash)
+
+	default:
+		genesisUsage()
+	}
+}
+
+// splitAmount parses a key=amount flag value
+func splitAmount(value string) (string, uint64, error) {
+	key, amount, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return "", 0, fmt.Errorf("expected key=amount")
+	}
+	n, err := strconv.ParseUint(amount, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid amount: %w", err)
+	}
+	return key, n, nil
+}
+
+// genesisUsage prints usage for the genesis command and exits
+func genesisUsage() {
+	fmt.Fprintln(os.Stderr, "usage: aetheria genesis init [-genesis file] [-chain-id id] [-time unix] [-alloc address=amount]... [-validator publickey=stake]... [consensus parameter flags]")
+	fmt.Fprintln(os.Stderr, "       aetheria genesis hash [-genesis file]")
+	os.Exit(2)
+}
@@ -6,27 +6,34 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/aetheria/blockchain/pkg/api"
 	"github.com/aetheria/blockchain/pkg/blockchain"
 	"github.com/aetheria/blockchain/pkg/consensus"
-	"github.com/aetheria/blockchain/pkg/crypto"
+	"github.com/aetheria/blockchain/pkg/monetary"
 	"github.com/aetheria/blockchain/pkg/network"
 	"github.com/aetheria/blockchain/pkg/wallet"
 )
 
 const (
-	// Initial supply of Aetheria tokens
-	InitialSupply = 1000000
-	// Minimum stake to become a validator
-	MinStake = 1000
-	// Block time (time between blocks)
-	BlockTime = 5 * time.Second
+	// Number of state snapshots kept on disk
+	SnapshotsKept = 3
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		runSnapshotCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "genesis" {
+		runGenesisCommand(os.Args[2:])
+		return
+	}
+
 	// Command line flags
 	var (
 		port        = flag.Int("port", 8080, "API server port")
@@ -34,8 +41,12 @@ func main() {
 		isValidator = flag.Bool("validator", false, "Run as validator")
 		walletFile  = flag.String("wallet", "", "Wallet file path")
 		newWallet   = flag.Bool("new-wallet", false, "Create new wallet")
-		genesisAddr = flag.String("genesis", "", "Genesis address (for first node)")
+		genesisFile = flag.String("genesis", "genesis.json", "Genesis file (create one with `aetheria genesis init`)")
+		dataDir     = flag.String("data-dir", "", "Data directory (default: data/<node-id>)")
+		snapEvery   = flag.Uint64("snapshot-interval", 1000, "Blocks between state snapshots (0 disables)")
+		forkChoice  = flag.String("fork-choice", "longest", "Fork choice rule: longest or heaviest")
 	)
+	mempoolConfig := mempoolFlags(flag.CommandLine)
 	flag.Parse()
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
@@ -47,28 +58,40 @@ func main() {
 		return
 	}
 
-	// Determine genesis address
-	var genesisAddress string
-	if *genesisAddr != "" {
-		genesisAddress = *genesisAddr
-	} else {
-		// Generate a default genesis address
-		keyPair, err := crypto.GenerateKeyPair()
-		if err != nil {
-			log.Fatalf("Failed to generate genesis key pair: %v", err)
-		}
-		genesisAddress = keyPair.Address()
-		log.Printf("Generated genesis address: %s", genesisAddress)
+	// Load the genesis document shared by every node of the network
+	genesis, err := blockchain.LoadGenesis(*genesisFile)
+	if err != nil {
+		log.Fatalf("Failed to load genesis: %v", err)
 	}
 
-	// Create blockchain
-	bc := blockchain.NewBlockchain(genesisAddress, InitialSupply)
-	log.Printf("Blockchain initialized with genesis address: %s", genesisAddress)
-	log.Printf("Initial supply: %d Aetheria tokens", InitialSupply)
+	// Open block and snapshot stores
+	if *dataDir == "" {
+		*dataDir = filepath.Join("data", *nodeID)
+	}
+	store, snapshots, err := openStores(*dataDir, *snapEvery)
+	if err != nil {
+		log.Fatalf("Failed to open data directory: %v", err)
+	}
+	defer store.Close()
+
+	rule, err := parseForkChoice(*forkChoice)
+	if err != nil {
+		log.Fatalf("Invalid fork choice: %v", err)
+	}
 
 	// Create consensus engine
-	pos := consensus.NewPoS(MinStake, BlockTime)
-	log.Printf("PoS consensus initialized (MinStake: %d, BlockTime: %v)", MinStake, BlockTime)
+	pos := newPoS(genesis)
+
+	// Create blockchain (reopens existing chain data if present); the
+	// consensus engine decides block rewards under the genesis policy
+	bc, err := blockchain.NewBlockchain(store, snapshots, rule, genesis, pos, blockchain.NewMempool(*mempoolConfig))
+	if err != nil {
+		log.Fatalf("Failed to initialize blockchain: %v", err)
+	}
+	log.Printf("Blockchain loaded from %s (height %d)", *dataDir, bc.Height())
+	log.Printf("Chain %s, genesis block %s", genesis.ChainID, bc.GetBlock(0).Hash)
+
+	log.Printf("PoS consensus initialized (MinStake: %d, BlockTime: %v)", pos.MinStake, pos.BlockTime)
 
 	// Create node
 	nodeAddress := fmt.Sprintf("localhost:%d", *port)
@@ -90,22 +113,16 @@ func main() {
 			log.Fatalf("Failed to get key pair: %v", err)
 		}
 
-		// Add initial stake for validator
-		if err := bc.State.AddStake(w.Address, MinStake); err != nil {
-			// If stake fails, give the validator some initial balance
-			bc.State.SetBalance(w.Address, MinStake*2)
-			if err := bc.State.AddStake(w.Address, MinStake); err != nil {
-				log.Fatalf("Failed to add stake: %v", err)
-			}
-		}
-
-		validator := consensus.ValidatorFromKeyPair(keyPair, MinStake)
+		// The validator must be bonded in the genesis file or by a stake
+		// transaction, and elected into the current epoch's validator set
+		stake := bc.HeadState().GetStake(w.Address)
+		validator := consensus.ValidatorFromKeyPair(keyPair, stake)
 		if err := node.SetValidator(validator); err != nil {
 			log.Fatalf("Failed to set validator: %v", err)
 		}
 
 		log.Printf("Node running as validator: %s", w.Address)
-		log.Printf("Validator stake: %d Aetheria", MinStake)
+		log.Printf("Validator stake: %d Aetheria", stake)
 	}
 
 	// Start node
@@ -134,6 +151,81 @@ func main() {
 	node.Stop()
 }
 
+// newPoS creates the consensus engine for the chain genesis describes, which
+// produces a block per slot and requires the genesis minimum validator stake
+func newPoS(genesis *blockchain.Genesis) *consensus.PoS {
+	blockTime := time.Duration(genesis.Params.SlotDuration) * time.Second
+	return consensus.NewPoS(genesis.Params.MinValidatorStake, blockTime, genesis.Params.Monetary)
+}
+
+// openStores opens the block store and snapshot store in dataDir
+func openStores(dataDir string, snapshotInterval uint64) (*blockchain.FileBlockStore, *blockchain.SnapshotStore, error) {
+	store, err := blockchain.OpenFileBlockStore(dataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snapshots, err := blockchain.NewSnapshotStore(filepath.Join(dataDir, "snapshots"), snapshotInterval, SnapshotsKept)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+
+	return store, snapshots, nil
+}
+
+// paramFlags registers flags for the consensus parameters on fs and returns
+// the parameters they fill in once fs is parsed
+func paramFlags(fs *flag.FlagSet) *blockchain.Params {
+	params := blockchain.DefaultParams()
+	fs.Uint64Var(&params.UnbondingPeriod, "unbonding-period", params.UnbondingPeriod, "Blocks before unstaked funds become spendable")
+	fs.Uint64Var(&params.SlashFraction, "slash-fraction", params.SlashFraction, "Basis points of stake slashed for double-signing")
+	fs.Uint64Var(&params.SlashRewardShare, "slash-reward-share", params.SlashRewardShare, "Basis points of slashed stake paid to the reporting proposer")
+	fs.Uint64Var(&params.MaxBlockBytes, "max-block-bytes", params.MaxBlockBytes, "Maximum block size in bytes (0 means unlimited)")
+	fs.Uint64Var(&params.MaxBlockTxs, "max-block-txs", params.MaxBlockTxs, "Maximum transactions per block (0 means unlimited)")
+	fs.Uint64Var(&params.EpochLength, "epoch-length", params.EpochLength, "Blocks per epoch; the validator set is elected at each epoch start")
+	fs.Uint64Var(&params.MaxValidators, "max-validators", params.MaxValidators, "Size of the active validator set, by voting power (0 means unlimited)")
+	fs.Uint64Var(&params.MinValidatorStake, "min-validator-stake", params.MinValidatorStake, "Least own stake a validator needs to be elected")
+	fs.Uint64Var(&params.SlotDuration, "slot-duration", params.SlotDuration, "Seconds per block slot, each led by an elected validator")
+
+	policy := &params.Monetary
+	fs.Func("reward-schedule", "Block reward schedule: fixed, halving or inflation (default fixed)", func(value string) error {
+		policy.Schedule = monetary.Schedule(value)
+		return nil
+	})
+	fs.Uint64Var(&policy.BlockReward, "block-reward", policy.BlockReward, "Fixed block reward, or the first reward of a halving schedule")
+	fs.Uint64Var(&policy.HalvingInterval, "halving-interval", policy.HalvingInterval, "Blocks between reward halvings")
+	fs.Uint64Var(&policy.InflationMin, "inflation-min", policy.InflationMin, "Yearly inflation at or above the target staking ratio, in basis points")
+	fs.Uint64Var(&policy.InflationMax, "inflation-max", policy.InflationMax, "Yearly inflation with nothing staked, in basis points")
+	fs.Uint64Var(&policy.TargetStakingRatio, "target-staking-ratio", policy.TargetStakingRatio, "Share of the supply the inflation schedule aims to have staked, in basis points")
+	fs.Uint64Var(&policy.BlocksPerYear, "blocks-per-year", policy.BlocksPerYear, "Blocks per year, used to spread yearly inflation over blocks")
+	fs.Uint64Var(&policy.FeeBurnShare, "fee-burn-share", policy.FeeBurnShare, "Basis points of each block's fees burned")
+	return &params
+}
+
+// mempoolFlags registers flags for the mempool limits on fs and returns the
+// configuration they fill in once fs is parsed
+func mempoolFlags(fs *flag.FlagSet) *blockchain.MempoolConfig {
+	config := blockchain.DefaultMempoolConfig()
+	fs.IntVar(&config.MaxSize, "mempool-size", config.MaxSize, "Maximum transactions held in the mempool (0 means unlimited)")
+	fs.IntVar(&config.MaxPerSender, "mempool-per-sender", config.MaxPerSender, "Maximum mempool transactions per sender (0 means unlimited)")
+	fs.DurationVar(&config.Expiry, "mempool-expiry", config.Expiry, "How long a transaction may wait in the mempool (0 means forever)")
+	fs.Uint64Var(&config.PriceBump, "mempool-price-bump", config.PriceBump, "Minimum fee increase in percent to replace a pending transaction")
+	return &config
+}
+
+// parseForkChoice returns the fork choice rule with the given name
+func parseForkChoice(name string) (blockchain.ForkChoice, error) {
+	switch name {
+	case "longest":
+		return blockchain.LongestChain{}, nil
+	case "heaviest":
+		return blockchain.HeaviestChain{}, nil
+	default:
+		return nil, fmt.Errorf("unknown fork choice rule %q", name)
+	}
+}
+
 // createNewWallet creates a new wallet and saves it to a file
 func createNewWallet() {
 	w, err := wallet.NewWallet()
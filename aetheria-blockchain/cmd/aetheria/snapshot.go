@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/aetheria/blockchain/pkg/blockchain"
+)
+
+// runSnapshotCommand handles `aetheria snapshot <create|list|verify>`
+func runSnapshotCommand(args []string) {
+	if len(args) == 0 {
+		snapshotUsage()
+	}
+
+	fs := flag.NewFlagSet("snapshot "+args[0], flag.ExitOnError)
+	dataDir := fs.String("data-dir", "data/node1", "Data directory")
+	height := fs.Uint64("height", 0, "Snapshot height to verify (default: all)")
+	forkChoice := fs.String("fork-choice", "longest", "Fork choice rule: longest or heaviest")
+	genesisFile := fs.String("genesis", "genesis.json", "Genesis file the chain was created from")
+	fs.Parse(args[1:])
+
+	switch args[0] {
+	case "create":
+		bc, _ := openExistingChain(*dataDir, *forkChoice, *genesisFile)
+		snap, err := bc.CreateSnapshot()
+		if err != nil {
+			log.Fatalf("Failed to create snapshot: %v", err)
+		}
+		fmt.Printf("Created snapshot at height %d (block %s)\n", snap.Height, snap.BlockHash)
+
+	case "list":
+		_, snapshots, err := openStores(*dataDir, 0)
+		if err != nil {
+			log.Fatalf("Failed to open data directory: %v", err)
+		}
+		heights, err := snapshots.List()
+		if err != nil {
+			log.Fatalf("Failed to list snapshots: %v", err)
+		}
+		for _, h := range heights {
+			snap, err := snapshots.Load(h)
+			if err != nil {
+				fmt.Printf("%d\tINVALID\t%v\n", h, err)
+				continue
+			}
+			fmt.Printf("%d\t%s\t%s\n", snap.Height, snap.BlockHash, snap.Checksum)
+		}
+
+	case "verify":
+		bc, snapshots := openExistingChain(*dataDir, *forkChoice, *genesisFile)
+		heights, err := snapshots.List()
+		if err != nil {
+			log.Fatalf("Failed to list snapshots: %v", err)
+		}
+		if *height != 0 {
+			heights = []uint64{*height}
+		}
+
+		failed := false
+		for _, h := range heights {
+			snap, err := snapshots.Load(h)
+			if err == nil {
+				err = bc.VerifySnapshot(snap)
+			}
+			if err != nil {
+				fmt.Printf("%d\tFAIL\t%v\n", h, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%d\tOK\n", h)
+		}
+		if failed {
+			os.Exit(1)
+		}
+
+	default:
+		snapshotUsage()
+	}
+}
+
+// openExistingChain loads the chain in dataDir, failing if there is none
+func openExistingChain(dataDir, forkChoice, genesisFile string) (*blockchain.Blockchain, *blockchain.SnapshotStore) {
+	rule, err := parseForkChoice(forkChoice)
+	if err != nil {
+		log.Fatalf("Invalid fork choice: %v", err)
+	}
+
+	genesis, err := blockchain.LoadGenesis(genesisFile)
+	if err != nil {
+		log.Fatalf("Failed to load genesis: %v", err)
+	}
+
+	store, snapshots, err := openStores(dataDir, 0)
+	if err != nil {
+		log.Fatalf("Failed to open data directory: %v", err)
+	}
+
+	blocks, err := store.Blocks()
+	if err != nil {
+		log.Fatalf("Failed to read blocks: %v", err)
+	}
+	if len(blocks) == 0 {
+		log.Fatalf("No chain data in %s", dataDir)
+	}
+
+	bc, err := blockchain.NewBlockchain(store, snapshots, rule, genesis, newPoS(genesis), nil)
+	if err != nil {
+		log.Fatalf("Failed to load blockchain: %v", err)
+	}
+	return bc, snapshots
+}
+
+// snapshotUsage prints usage for the snapshot command and exits
+func snapshotUsage() {
+	fmt.Fprintln(os.Stderr, "usage: aetheria snapshot <create|list|verify> [-data-dir dir] [-height n] [-fork-choice rule] [-genesis file]")
+	os.Exit(2)
+}
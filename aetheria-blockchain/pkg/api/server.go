@@ -6,10 +6,12 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/aetheria/blockchain/pkg/blockchain"
 	"github.com/aetheria/blockchain/pkg/consensus"
 	"github.com/aetheria/blockchain/pkg/crypto"
+	"github.com/aetheria/blockchain/pkg/events"
 	"github.com/aetheria/blockchain/pkg/network"
 )
 
@@ -39,9 +41,26 @@ func (s *Server) Start() error {
 	http.HandleFunc("/block/", s.handleBlock)
 	http.HandleFunc("/transactions", s.handleTransactions)
 	http.HandleFunc("/transaction/", s.handleTransaction)
+	http.HandleFunc("/receipt/", s.handleReceipt)
 	http.HandleFunc("/balance/", s.handleBalance)
+	http.HandleFunc("/address/", s.handleAddress)
+	http.HandleFunc("/proof/tx/", s.handleTxProof)
+	http.HandleFunc("/proof/balance/", s.handleBalanceProof)
 	http.HandleFunc("/stake", s.handleStake)
+	http.HandleFunc("/unstake", s.handleUnstake)
+	http.HandleFunc("/delegate", s.handleDelegate)
+	http.HandleFunc("/undelegate", s.handleUndelegate)
+	http.HandleFunc("/commission", s.handleCommission)
+	http.HandleFunc("/unbonding/", s.handleUnbonding)
 	http.HandleFunc("/validators", s.handleValidators)
+	http.HandleFunc("/supply", s.handleSupply)
+	http.HandleFunc("/assets", s.handleAssets)
+	http.HandleFunc("/assets/", s.handleAssetTransaction)
+	http.HandleFunc("/asset/", s.handleAsset)
+	http.HandleFunc("/htlcs", s.handleHTLCs)
+	http.HandleFunc("/htlcs/", s.handleHTLCTransaction)
+	http.HandleFunc("/htlc/", s.handleHTLC)
+	http.HandleFunc("/events", s.handleEvents)
 	http.HandleFunc("/wallet/new", s.handleNewWallet)
 
 	addr := fmt.Sprintf(":%d", s.Port)
@@ -52,9 +71,10 @@ func (s *Server) Start() error {
 // handleRoot handles root endpoint
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
-		"name":    "Aetheria Blockchain",
-		"version": "1.0.0",
-		"height":  s.Blockchain.Height(),
+		"name":             "Aetheria Blockchain",
+		"version":          "1.0.0",
+		"height":           s.Blockchain.Height(),
+		"finalized_height": s.Blockchain.FinalizedHeight(),
 	}
 	s.jsonResponse(w, response)
 }
@@ -76,9 +96,21 @@ func (s *Server) handleBlocks(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getBlocks returns all blocks
+// getBlocks returns the canonical blocks, all of them by default or up to
+// ?limit=N starting at ?from=N
 func (s *Server) getBlocks(w http.ResponseWriter, r *http.Request) {
-	blocks := s.Blockchain.Blocks
+	from, err := queryInt(r, "from", 0)
+	if err != nil {
+		http.Error(w, "Invalid from", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", 0)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	blocks := s.Blockchain.BlocksRange(uint64(from), limit)
 	s.jsonResponse(w, blocks)
 }
 
@@ -103,7 +135,12 @@ func (s *Server) handleBlock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.jsonResponse(w, block)
+	// A block is final once it or a block above it has a commit
+	response := struct {
+		*blockchain.Block
+		Final bool `json:"final"`
+	}{block, s.Blockchain.IsFinal(index)}
+	s.jsonResponse(w, response)
 }
 
 // handleTransactions handles transactions endpoint
@@ -119,11 +156,12 @@ func (s *Server) handleTransactions(w http.ResponseWriter, r *http.Request) {
 
 // TransactionRequest represents a transaction creation request
 type TransactionRequest struct {
-	From       string `json:"from"`
-	To         string `json:"to"`
-	Amount     uint64 `json:"amount"`
-	Fee        uint64 `json:"fee"`
-	PrivateKey string `json:"private_key"`
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Amount     uint64  `json:"amount"`
+	Fee        uint64  `json:"fee"`
+	Nonce      *uint64 `json:"nonce,omitempty"` // defaults to the sender's next nonce
+	PrivateKey string  `json:"private_key"`
 }
 
 // createTransaction creates a new transaction
@@ -135,7 +173,11 @@ func (s *Server) createTransaction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create transaction
-	tx := blockchain.NewTransaction(req.From, req.To, req.Amount, req.Fee)
+	nonce := s.Blockchain.NextNonce(req.From)
+	if req.Nonce != nil {
+		nonce = *req.Nonce
+	}
+	tx := blockchain.NewTransaction(s.Blockchain.ChainID(), req.From, req.To, req.Amount, req.Fee, nonce)
 
 	// Sign transaction
 	privateKey, err := crypto.PrivateKeyFromHex(req.PrivateKey)
@@ -163,7 +205,7 @@ func (s *Server) createTransaction(w http.ResponseWriter, r *http.Request) {
 
 // getPendingTransactions returns pending transactions
 func (s *Server) getPendingTransactions(w http.ResponseWriter, r *http.Request) {
-	s.jsonResponse(w, s.Blockchain.PendingTxs)
+	s.jsonResponse(w, s.Blockchain.PendingTransactions())
 }
 
 // handleTransaction handles single transaction endpoint
@@ -183,6 +225,125 @@ func (s *Server) handleTransaction(w http.ResponseWriter, r *http.Request) {
 	s.jsonResponse(w, tx)
 }
 
+// handleReceipt returns the execution receipt of a mined transaction
+func (s *Server) handleReceipt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	txID := r.URL.Path[len("/receipt/"):]
+	if _, ok := s.Blockchain.GetTransactionLocation(txID); !ok {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	receipt, err := s.Blockchain.GetReceipt(txID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to compute receipt: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.jsonResponse(w, receipt)
+}
+
+// handleEvents streams chain, mempool and peer events as server-sent
+// events, named by topic. ?topics=new_block,tx_added limits the stream to
+// those topics. A client too slow to keep up is disconnected.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var topics []events.Topic
+	if list := r.URL.Query().Get("topics"); list != "" {
+		for _, name := range strings.Split(list, ",") {
+			topic, err := events.ParseTopic(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			topics = append(topics, topic)
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := s.Blockchain.Events().Subscribe(events.DefaultBuffer, events.Disconnect, topics...)
+	defer sub.Unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, open := <-sub.Events():
+			if !open {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("Failed to encode %s event: %v", ev.Topic(), err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Topic(), data)
+			flusher.Flush()
+		}
+	}
+}
+
+// handleTxProof returns a Merkle inclusion proof for a mined transaction
+func (s *Server) handleTxProof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	txID := r.URL.Path[len("/proof/tx/"):]
+	proof, err := s.Blockchain.GetTransactionProof(txID)
+	if err != nil {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	s.jsonResponse(w, proof)
+}
+
+// handleBalanceProof returns an account proof against a block's state root.
+// The block defaults to the chain tip and can be chosen with ?block=N.
+func (s *Server) handleBalanceProof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	address := r.URL.Path[len("/proof/balance/"):]
+	height := s.Blockchain.Height() - 1
+	if blockStr := r.URL.Query().Get("block"); blockStr != "" {
+		n, err := strconv.ParseUint(blockStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid block index", http.StatusBadRequest)
+			return
+		}
+		height = n
+	}
+
+	proof, err := s.Blockchain.GetAccountProof(address, height)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	s.jsonResponse(w, proof)
+}
+
 // handleBalance handles balance endpoint
 func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -191,25 +352,144 @@ func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
 	}
 
 	address := r.URL.Path[len("/balance/"):]
-	balance := s.Blockchain.State.GetBalance(address)
-	stake := s.Blockchain.State.GetStake(address)
+	state := s.Blockchain.HeadState()
+	balance := state.GetBalance(address)
+	stake := state.GetStake(address)
+	unbonding := state.TotalUnbonding(address)
+	delegations := state.GetDelegations(address)
+	assets := state.GetAssetBalances(address)
+
+	response := map[string]interface{}{
+		"address":     address,
+		"balance":     balance,
+		"stake":       stake,
+		"unbonding":   unbonding,
+		"delegations": delegations,
+		"assets":      assets,
+	}
+	s.jsonResponse(w, response)
+}
 
+// handleUnbonding lists an address's unstaked funds still waiting out the
+// unbonding period
+func (s *Server) handleUnbonding(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	address := r.URL.Path[len("/unbonding/"):]
+	if address == "" {
+		http.Error(w, "Address required", http.StatusBadRequest)
+		return
+	}
+
+	state := s.Blockchain.HeadState()
 	response := map[string]interface{}{
 		"address": address,
-		"balance": balance,
-		"stake":   stake,
+		"total":   state.TotalUnbonding(address),
+		"entries": state.GetUnbonding(address),
+	}
+	s.jsonResponse(w, response)
+}
+
+// handleAddress handles address history endpoint: /address/{addr}/transactions
+func (s *Server) handleAddress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path[len("/address/"):], "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "transactions" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	address := parts[0]
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", 100)
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	txs, total := s.Blockchain.GetAddressTransactions(address, offset, limit)
+	response := map[string]interface{}{
+		"address":      address,
+		"total":        total,
+		"offset":       offset,
+		"transactions": txs,
 	}
 	s.jsonResponse(w, response)
 }
 
-// StakeRequest represents a stake request
+// queryInt parses a non-negative integer query parameter
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return n, nil
+}
+
+// StakeRequest represents a staking, delegation or commission request
 type StakeRequest struct {
-	Address string `json:"address"`
-	Amount  uint64 `json:"amount"`
+	Address    string  `json:"address"`
+	Validator  string  `json:"validator,omitempty"` // delegation target
+	Amount     uint64  `json:"amount"`
+	Commission uint64  `json:"commission,omitempty"` // basis points
+	Fee        uint64  `json:"fee"`
+	Nonce      *uint64 `json:"nonce,omitempty"` // defaults to the sender's next nonce
+	PrivateKey string  `json:"private_key"`
 }
 
 // handleStake handles staking endpoint
 func (s *Server) handleStake(w http.ResponseWriter, r *http.Request) {
+	s.submitStakeTransaction(w, r, func(req *StakeRequest, nonce uint64) *blockchain.Transaction {
+		return blockchain.NewStakeTransaction(s.Blockchain.ChainID(), req.Address, req.Amount, req.Fee, nonce)
+	})
+}
+
+// handleUnstake handles unstaking endpoint
+func (s *Server) handleUnstake(w http.ResponseWriter, r *http.Request) {
+	s.submitStakeTransaction(w, r, func(req *StakeRequest, nonce uint64) *blockchain.Transaction {
+		return blockchain.NewUnstakeTransaction(s.Blockchain.ChainID(), req.Address, req.Amount, req.Fee, nonce)
+	})
+}
+
+// handleDelegate handles delegation endpoint
+func (s *Server) handleDelegate(w http.ResponseWriter, r *http.Request) {
+	s.submitStakeTransaction(w, r, func(req *StakeRequest, nonce uint64) *blockchain.Transaction {
+		return blockchain.NewDelegateTransaction(s.Blockchain.ChainID(), req.Address, req.Validator, req.Amount, req.Fee, nonce)
+	})
+}
+
+// handleUndelegate handles undelegation endpoint
+func (s *Server) handleUndelegate(w http.ResponseWriter, r *http.Request) {
+	s.submitStakeTransaction(w, r, func(req *StakeRequest, nonce uint64) *blockchain.Transaction {
+		return blockchain.NewUndelegateTransaction(s.Blockchain.ChainID(), req.Address, req.Validator, req.Amount, req.Fee, nonce)
+	})
+}
+
+// handleCommission handles the validator commission endpoint
+func (s *Server) handleCommission(w http.ResponseWriter, r *http.Request) {
+	s.submitStakeTransaction(w, r, func(req *StakeRequest, nonce uint64) *blockchain.Transaction {
+		return blockchain.NewSetCommissionTransaction(s.Blockchain.ChainID(), req.Address, req.Commission, req.Fee, nonce)
+	})
+}
+
+// submitStakeTransaction signs a staking transaction built by newTx and
+// submits it to the pool; stakes change once it is included in a block
+func (s *Server) submitStakeTransaction(w http.ResponseWriter, r *http.Request, newTx func(req *StakeRequest, nonce uint64) *blockchain.Transaction) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -221,17 +501,35 @@ func (s *Server) handleStake(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Add stake
-	if err := s.Blockchain.State.AddStake(req.Address, req.Amount); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to add stake: %v", err), http.StatusBadRequest)
+	nonce := s.Blockchain.NextNonce(req.Address)
+	if req.Nonce != nil {
+		nonce = *req.Nonce
+	}
+	s.signAndSubmit(w, newTx(&req, nonce), req.PrivateKey)
+}
+
+// signAndSubmit signs tx with a hex private key, submits it to the pool and
+// broadcasts it
+func (s *Server) signAndSubmit(w http.ResponseWriter, tx *blockchain.Transaction, privateKeyHex string) {
+	privateKey, err := crypto.PrivateKeyFromHex(privateKeyHex)
+	if err != nil {
+		http.Error(w, "Invalid private key", http.StatusBadRequest)
 		return
 	}
 
-	response := map[string]interface{}{
-		"address": req.Address,
-		"stake":   s.Blockchain.State.GetStake(req.Address),
+	if err := tx.Sign(privateKey); err != nil {
+		http.Error(w, "Failed to sign transaction", http.StatusInternalServerError)
+		return
 	}
-	s.jsonResponse(w, response)
+
+	if err := s.Blockchain.AddTransaction(tx); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to add transaction: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.Node.BroadcastTransaction(tx)
+
+	s.jsonResponse(w, tx)
 }
 
 // handleValidators handles validators endpoint
@@ -241,10 +539,198 @@ func (s *Server) handleValidators(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	validators := s.Consensus.ValidatorSet.GetValidatorInfos()
+	validators := s.Consensus.Validators().GetValidatorInfos()
 	s.jsonResponse(w, validators)
 }
 
+// handleAssets lists every issued asset
+func (s *Server) handleAssets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.jsonResponse(w, s.Blockchain.HeadState().GetAssets())
+}
+
+// handleAsset handles /asset/{symbol} and /asset/{symbol}/holders
+func (s *Server) handleAsset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path[len("/asset/"):], "/"), "/")
+	state := s.Blockchain.HeadState()
+	asset, ok := state.GetAsset(parts[0])
+	if !ok {
+		http.Error(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		s.jsonResponse(w, asset)
+	case len(parts) == 2 && parts[1] == "holders":
+		response := map[string]interface{}{
+			"asset":   asset.Symbol,
+			"supply":  asset.Supply,
+			"holders": state.GetAssetHolders(asset.Symbol),
+		}
+		s.jsonResponse(w, response)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// AssetRequest represents an asset issue, mint, burn or transfer request
+type AssetRequest struct {
+	Address    string  `json:"address"`
+	To         string  `json:"to,omitempty"` // mint or transfer recipient
+	Asset      string  `json:"asset"`
+	Decimals   uint8   `json:"decimals,omitempty"`   // issue only
+	MaxSupply  uint64  `json:"max_supply,omitempty"` // issue only, 0 means uncapped
+	Amount     uint64  `json:"amount"`
+	Fee        uint64  `json:"fee"`
+	Nonce      *uint64 `json:"nonce,omitempty"` // defaults to the sender's next nonce
+	PrivateKey string  `json:"private_key"`
+}
+
+// handleAssetTransaction handles POST /assets/{issue|mint|burn|transfer}
+func (s *Server) handleAssetTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AssetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	nonce := s.Blockchain.NextNonce(req.Address)
+	if req.Nonce != nil {
+		nonce = *req.Nonce
+	}
+
+	chainID := s.Blockchain.ChainID()
+	var tx *blockchain.Transaction
+	switch r.URL.Path[len("/assets/"):] {
+	case "issue":
+		tx = blockchain.NewIssueAssetTransaction(chainID, req.Address, req.Asset, req.Decimals, req.MaxSupply, req.Amount, req.Fee, nonce)
+	case "mint":
+		tx = blockchain.NewMintAssetTransaction(chainID, req.Address, req.To, req.Asset, req.Amount, req.Fee, nonce)
+	case "burn":
+		tx = blockchain.NewBurnAssetTransaction(chainID, req.Address, req.Asset, req.Amount, req.Fee, nonce)
+	case "transfer":
+		tx = blockchain.NewTransferAssetTransaction(chainID, req.Address, req.To, req.Asset, req.Amount, req.Fee, nonce)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	s.signAndSubmit(w, tx, req.PrivateKey)
+}
+
+// handleSupply reports the coins minted and burned so far and how much of
+// the supply is bonded or circulating
+func (s *Server) handleSupply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	supply := s.Blockchain.HeadState().GetSupply()
+	response := map[string]interface{}{
+		"height":        s.Blockchain.Height(),
+		"total_minted":  supply.Minted,
+		"total_burned":  supply.Burned,
+		"total_supply":  supply.Total(),
+		"bonded":        supply.Bonded,
+		"unbonding":     supply.Unbonding,
+		"locked":        supply.Locked,
+		"circulating":   supply.Circulating(),
+		"staking_ratio": supply.StakingRatio(),
+	}
+	s.jsonResponse(w, response)
+}
+
+// handleHTLCs lists every open hash-time-locked contract
+func (s *Server) handleHTLCs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.jsonResponse(w, s.Blockchain.HeadState().GetHTLCs())
+}
+
+// handleHTLC returns the open contracts locked to a hash: /htlc/{hashlock}
+func (s *Server) handleHTLC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	htlcs := s.Blockchain.HeadState().GetHTLCsByHashLock(r.URL.Path[len("/htlc/"):])
+	if len(htlcs) == 0 {
+		http.Error(w, "HTLC not found", http.StatusNotFound)
+		return
+	}
+	s.jsonResponse(w, htlcs)
+}
+
+// HTLCRequest represents an HTLC lock, claim or refund request
+type HTLCRequest struct {
+	Address    string  `json:"address"`
+	To         string  `json:"to,omitempty"`          // lock recipient
+	Asset      string  `json:"asset,omitempty"`       // lock only, empty for the native token
+	HashLock   string  `json:"hash_lock,omitempty"`   // lock only
+	ContractID string  `json:"contract_id,omitempty"` // claim and refund, the lock transaction ID
+	Preimage   string  `json:"preimage,omitempty"`    // claim only, hex
+	Amount     uint64  `json:"amount,omitempty"`      // lock only
+	Expiry     uint64  `json:"expiry,omitempty"`      // lock only, block height
+	Fee        uint64  `json:"fee"`
+	Nonce      *uint64 `json:"nonce,omitempty"` // defaults to the sender's next nonce
+	PrivateKey string  `json:"private_key"`
+}
+
+// handleHTLCTransaction handles POST /htlcs/{lock|claim|refund}
+func (s *Server) handleHTLCTransaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req HTLCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	nonce := s.Blockchain.NextNonce(req.Address)
+	if req.Nonce != nil {
+		nonce = *req.Nonce
+	}
+
+	chainID := s.Blockchain.ChainID()
+	var tx *blockchain.Transaction
+	switch r.URL.Path[len("/htlcs/"):] {
+	case "lock":
+		tx = blockchain.NewLockHTLCTransaction(chainID, req.Address, req.To, req.Asset, req.HashLock, req.Amount, req.Expiry, req.Fee, nonce)
+	case "claim":
+		tx = blockchain.NewClaimHTLCTransaction(chainID, req.Address, req.ContractID, req.Preimage, req.Fee, nonce)
+	case "refund":
+		tx = blockchain.NewRefundHTLCTransaction(chainID, req.Address, req.ContractID, req.Fee, nonce)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	s.signAndSubmit(w, tx, req.PrivateKey)
+}
+
 // handleNewWallet handles wallet creation endpoint
 func (s *Server) handleNewWallet(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -0,0 +1,272 @@
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aetheria/blockchain/pkg/codec"
+)
+
+const (
+	// NativeAsset is the symbol of the chain's own token, held in
+	// State.Balances; it cannot be issued
+	NativeAsset = "AET"
+	// MaxAssetDecimals is the most decimals an issued asset may declare
+	MaxAssetDecimals = 18
+	// assetKeyPrefix keys asset definitions in the state tree; addresses are
+	// hex, so the prefix cannot collide with an account key
+	assetKeyPrefix = "asset:"
+)
+
+// Asset is a token issued on the chain by a TxIssueAsset transaction
+type Asset struct {
+	Symbol    string `json:"symbol"`
+	Decimals  uint8  `json:"decimals"`
+	Issuer    string `json:"issuer"`     // the only address allowed to mint
+	MaxSupply uint64 `json:"max_supply"` // 0 means uncapped
+	Supply    uint64 `json:"supply"`     // amount issued and not burned
+}
+
+// Encode returns the asset's canonical leaf value in the state tree
+func (a *Asset) Encode() []byte {
+	enc := codec.NewEncoder()
+	enc.WriteString(a.Symbol)
+	enc.WriteUint8(a.Decimals)
+	enc.WriteString(a.Issuer)
+	enc.WriteUint64(a.MaxSupply)
+	enc.WriteUint64(a.Supply)
+	return enc.Bytes()
+}
+
+// AssetBalance is an address's holding of an issued asset
+type AssetBalance struct {
+	Asset  string `json:"asset"`
+	Amount uint64 `json:"amount"`
+}
+
+// AssetHolder is an address holding an issued asset
+type AssetHolder struct {
+	Address string `json:"address"`
+	Amount  uint64 `json:"amount"`
+}
+
+// ValidateAssetSymbol checks that symbol can name an issued asset: 2 to 12
+// upper-case letters and digits, starting with a letter
+func ValidateAssetSymbol(symbol string) error {
+	if len(symbol) < 2 || len(symbol) > 12 {
+		return fmt.Errorf("asset symbol %q must be 2 to 12 characters", symbol)
+	}
+	for i, c := range symbol {
+		if (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return fmt.Errorf("asset symbol %q must be upper-case letters and digits, starting with a letter", symbol)
+		}
+	}
+	if symbol == NativeAsset {
+		return fmt.Errorf("asset symbol %s is reserved for the native token", symbol)
+	}
+	return nil
+}
+
+// GetAsset returns an issued asset's definition
+func (s *State) GetAsset(symbol string) (Asset, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	asset, ok := s.Assets[symbol]
+	return asset, ok
+}
+
+// GetAssets returns every issued asset, sorted by symbol
+func (s *State) GetAssets() []Asset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	assets := make([]Asset, 0, len(s.Assets))
+	for _, asset := range s.Assets {
+		assets = append(assets, asset)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return assets[i].Symbol < assets[j].Symbol
+	})
+	return assets
+}
+
+// GetAssetBalance returns an address's balance of an issued asset
+func (s *State) GetAssetBalance(address, symbol string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.AssetBalances[address][symbol]
+}
+
+// GetAssetBalances returns an address's issued asset balances, sorted by
+// symbol
+func (s *State) GetAssetBalances(address string) []AssetBalance {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.assetBalances(address)
+}
+
+// assetBalances returns sorted asset balances; callers must hold s.mu
+func (s *State) assetBalances(address string) []AssetBalance {
+	balances := make([]AssetBalance, 0, len(s.AssetBalances[address]))
+	for symbol, amount := range s.AssetBalances[address] {
+		balances = append(balances, AssetBalance{Asset: symbol, Amount: amount})
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Asset < balances[j].Asset
+	})
+	return balances
+}
+
+// GetAssetHolders returns every address holding an issued asset, largest
+// holding first
+func (s *State) GetAssetHolders(symbol string) []AssetHolder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	holders := make([]AssetHolder, 0)
+	for address, balances := range s.AssetBalances {
+		if amount := balances[symbol]; amount > 0 {
+			holders = append(holders, AssetHolder{Address: address, Amount: amount})
+		}
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		if holders[i].Amount != holders[j].Amount {
+			return holders[i].Amount > holders[j].Amount
+		}
+		return holders[i].Address < holders[j].Address
+	})
+	return holders
+}
+
+// applyIssueAsset defines a new asset issued by the sender and credits the
+// sender with Amount of it; callers must hold s.mu
+func (s *State) applyIssueAsset(tx *Transaction) error {
+	if err := ValidateAssetSymbol(tx.Asset); err != nil {
+		return err
+	}
+	if _, exists := s.Assets[tx.Asset]; exists {
+		return fmt.Errorf("asset %s already exists", tx.Asset)
+	}
+	if tx.Decimals > MaxAssetDecimals {
+		return fmt.Errorf("asset decimals %d exceed %d", tx.Decimals, MaxAssetDecimals)
+	}
+	if tx.MaxSupply > 0 && tx.Amount > tx.MaxSupply {
+		return fmt.Errorf("initial supply %d exceeds max supply %d", tx.Amount, tx.MaxSupply)
+	}
+
+	s.Balances[tx.From] -= tx.Fee
+	s.Assets[tx.Asset] = Asset{
+		Symbol:    tx.Asset,
+		Decimals:  tx.Decimals,
+		Issuer:    tx.From,
+		MaxSupply: tx.MaxSupply,
+		Supply:    tx.Amount,
+	}
+	s.touch(assetKeyPrefix + tx.Asset)
+	s.addAssetBalance(tx.From, tx.Asset, tx.Amount)
+	return nil
+}
+
+// applyMintAsset issues more of the sender's asset to To, or to the sender
+// when To is empty; callers must hold s.mu
+func (s *State) applyMintAsset(tx *Transaction) error {
+	asset, ok := s.Assets[tx.Asset]
+	if !ok {
+		return fmt.Errorf("unknown asset %s", tx.Asset)
+	}
+	if tx.From != asset.Issuer {
+		return fmt.Errorf("only issuer %s may mint %s", asset.Issuer, tx.Asset)
+	}
+	if tx.Amount == 0 {
+		return fmt.Errorf("mint amount must be positive")
+	}
+	if asset.Supply+tx.Amount < asset.Supply {
+		return fmt.Errorf("minting %d %s overflows its supply", tx.Amount, tx.Asset)
+	}
+	if asset.MaxSupply > 0 && asset.Supply+tx.Amount > asset.MaxSupply {
+		return fmt.Errorf("minting %d %s exceeds max supply %d", tx.Amount, tx.Asset, asset.MaxSupply)
+	}
+
+	recipient := tx.To
+	if recipient == "" {
+		recipient = tx.From
+	}
+	s.Balances[tx.From] -= tx.Fee
+	asset.Supply += tx.Amount
+	s.Assets[tx.Asset] = asset
+	s.touch(assetKeyPrefix + tx.Asset)
+	s.addAssetBalance(recipient, tx.Asset, tx.Amount)
+	return nil
+}
+
+// applyBurnAsset destroys Amount of the sender's holding of an asset;
+// callers must hold s.mu
+func (s *State) applyBurnAsset(tx *Transaction) error {
+	asset, ok := s.Assets[tx.Asset]
+	if !ok {
+		return fmt.Errorf("unknown asset %s", tx.Asset)
+	}
+	if tx.Amount == 0 {
+		return fmt.Errorf("burn amount must be positive")
+	}
+	if err := s.subAssetBalance(tx.From, tx.Asset, tx.Amount); err != nil {
+		return err
+	}
+
+	s.Balances[tx.From] -= tx.Fee
+	asset.Supply -= tx.Amount
+	s.Assets[tx.Asset] = asset
+	s.touch(assetKeyPrefix + tx.Asset)
+	return nil
+}
+
+// applyTransferAsset moves Amount of an asset from the sender to To;
+// callers must hold s.mu
+func (s *State) applyTransferAsset(tx *Transaction) error {
+	if _, ok := s.Assets[tx.Asset]; !ok {
+		return fmt.Errorf("unknown asset %s", tx.Asset)
+	}
+	if tx.Amount == 0 {
+		return fmt.Errorf("transfer amount must be positive")
+	}
+	if tx.To == "" {
+		return fmt.Errorf("asset transfer has no recipient")
+	}
+	if err := s.subAssetBalance(tx.From, tx.Asset, tx.Amount); err != nil {
+		return err
+	}
+
+	s.Balances[tx.From] -= tx.Fee
+	s.addAssetBalance(tx.To, tx.Asset, tx.Amount)
+	return nil
+}
+
+// addAssetBalance credits an asset balance; callers must hold s.mu
+func (s *State) addAssetBalance(address, symbol string, amount uint64) {
+	if amount == 0 {
+		return
+	}
+	if s.AssetBalances[address] == nil {
+		s.AssetBalances[address] = make(map[string]uint64)
+	}
+	s.AssetBalances[address][symbol] += amount
+	s.touch(address)
+}
+
+// subAssetBalance debits an asset balance, dropping it once empty; callers
+// must hold s.mu
+func (s *State) subAssetBalance(address, symbol string, amount uint64) error {
+	held := s.AssetBalances[address][symbol]
+	if held < amount {
+		return fmt.Errorf("insufficient %s balance: has %d, needs %d", symbol, held, amount)
+	}
+	s.AssetBalances[address][symbol] -= amount
+	if s.AssetBalances[address][symbol] == 0 {
+		delete(s.AssetBalances[address], symbol)
+	}
+	if len(s.AssetBalances[address]) == 0 {
+		delete(s.AssetBalances, address)
+	}
+	s.touch(address)
+	return nil
+}
@@ -12,43 +12,128 @@ import (
 
 // Block represents a block in the blockchain
 type Block struct {
-	Index        uint64         `json:"index"`
-	Timestamp    int64          `json:"timestamp"`
-	Transactions []*Transaction `json:"transactions"`
-	PrevHash     string         `json:"prev_hash"`
-	Hash         string         `json:"hash"`
-	Validator    string         `json:"validator"`
-	Signature    string         `json:"signature"`
+	ChainID          string         `json:"chain_id"`
+	Index            uint64         `json:"index"`
+	Timestamp        int64          `json:"timestamp"`
+	Transactions     []*Transaction `json:"transactions"`
+	PrevHash         string         `json:"prev_hash"`
+	TxRoot           string         `json:"tx_root"`
+	StateRoot        string         `json:"state_root"`
+	Evidence         []*Evidence    `json:"evidence,omitempty"`
+	EvidenceRoot     string         `json:"evidence_root"`
+	ReceiptsRoot     string         `json:"receipts_root"`
+	ValidatorSetHash string         `json:"validator_set_hash,omitempty"` // set elected by the first block of an epoch
+	RandaoReveal     string         `json:"randao_reveal,omitempty"`      // secret the validator committed to in its previous block
+	RandaoCommit     string         `json:"randao_commit"`                // hash of the secret its next block reveals
+	Hash             string         `json:"hash"`
+	Validator        string         `json:"validator"`
+	Signature        string         `json:"signature"`
+	Commit           *Commit        `json:"commit,omitempty"` // precommits that made the block final; not hashed
 }
 
-// NewBlock creates a new block
-func NewBlock(index uint64, transactions []*Transaction, prevHash, validator string) *Block {
+// BlockHeader is the signed part of a block, without its transactions or
+// evidence
+type BlockHeader struct {
+	ChainID          string `json:"chain_id"`
+	Index            uint64 `json:"index"`
+	Timestamp        int64  `json:"timestamp"`
+	PrevHash         string `json:"prev_hash"`
+	TxRoot           string `json:"tx_root"`
+	StateRoot        string `json:"state_root"`
+	EvidenceRoot     string `json:"evidence_root"`
+	ReceiptsRoot     string `json:"receipts_root"`
+	ValidatorSetHash string `json:"validator_set_hash,omitempty"`
+	RandaoReveal     string `json:"randao_reveal,omitempty"`
+	RandaoCommit     string `json:"randao_commit"`
+	Hash             string `json:"hash"`
+	Validator        string `json:"validator"`
+	Signature        string `json:"signature"`
+}
+
+// NewBlock creates a new block on the chain identified by chainID.
+// stateRoot is the root of the state that results from applying the block
+// and receiptsRoot the ReceiptsRoot of the receipts applying it produces.
+// validatorSetHash is the hash of the validator set the block elects if it
+// starts an epoch, and empty otherwise.
+func NewBlock(chainID string, index uint64, transactions []*Transaction, evidence []*Evidence, prevHash, validator, stateRoot, receiptsRoot, validatorSetHash string) *Block {
 	block := &Block{
-		Index:        index,
-		Timestamp:    time.Now().Unix(),
-		Transactions: transactions,
-		PrevHash:     prevHash,
-		Validator:    validator,
+		ChainID:          chainID,
+		Index:            index,
+		Timestamp:        time.Now().Unix(),
+		Transactions:     transactions,
+		PrevHash:         prevHash,
+		Validator:        validator,
+		StateRoot:        stateRoot,
+		Evidence:         evidence,
+		ReceiptsRoot:     receiptsRoot,
+		ValidatorSetHash: validatorSetHash,
 	}
+	block.TxRoot = block.calculateTxRoot()
+	block.EvidenceRoot = block.calculateEvidenceRoot()
 	block.Hash = block.calculateHash()
 	return block
 }
 
-// calculateHash calculates the hash of the block
+// Header returns a copy of the block's signed header
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		ChainID:          b.ChainID,
+		Index:            b.Index,
+		Timestamp:        b.Timestamp,
+		PrevHash:         b.PrevHash,
+		TxRoot:           b.TxRoot,
+		StateRoot:        b.StateRoot,
+		EvidenceRoot:     b.EvidenceRoot,
+		ReceiptsRoot:     b.ReceiptsRoot,
+		ValidatorSetHash: b.ValidatorSetHash,
+		RandaoReveal:     b.RandaoReveal,
+		RandaoCommit:     b.RandaoCommit,
+		Hash:             b.Hash,
+		Validator:        b.Validator,
+		Signature:        b.Signature,
+	}
+}
+
+// calculateHash calculates the hash of the block's canonical header encoding
 func (b *Block) calculateHash() string {
-	data := fmt.Sprintf("%d%d%s%s", b.Index, b.Timestamp, b.PrevHash, b.Validator)
-	
-	// Include all transaction hashes
-	for _, tx := range b.Transactions {
-		data += tx.ID
+	return crypto.HashString(b.EncodeHeader())
+}
+
+// txLeaves returns the Merkle leaves for the block's transactions
+func (b *Block) txLeaves() [][]byte {
+	leaves := make([][]byte, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		leaves[i] = txLeaf(tx.ID)
+	}
+	return leaves
+}
+
+// txLeaf returns the Merkle leaf for a transaction ID
+func txLeaf(txID string) []byte {
+	leaf, err := hex.DecodeString(txID)
+	if err != nil {
+		return []byte(txID)
 	}
-	
-	return crypto.HashString([]byte(data))
+	return leaf
+}
+
+// calculateTxRoot computes the Merkle root of the block's transaction IDs
+func (b *Block) calculateTxRoot() string {
+	return hex.EncodeToString(crypto.MerkleRoot(b.txLeaves()))
+}
+
+// calculateEvidenceRoot computes the Merkle root of the block's evidence IDs
+func (b *Block) calculateEvidenceRoot() string {
+	leaves := make([][]byte, len(b.Evidence))
+	for i, ev := range b.Evidence {
+		leaves[i] = txLeaf(ev.ID())
+	}
+	return hex.EncodeToString(crypto.MerkleRoot(leaves))
 }
 
 // Sign signs the block with validator's private key
 func (b *Block) Sign(privateKey []byte) error {
-	data := []byte(b.Hash)
+	data := b.EncodeHeader()
 	signature := crypto.Sign(privateKey, data)
 	b.Signature = crypto.SignatureToHex(signature)
 	return nil
@@ -56,6 +141,16 @@ func (b *Block) Sign(privateKey []byte) error {
 
 // Verify verifies the block's integrity and signature
 func (b *Block) Verify(publicKey []byte) error {
+	// Verify transaction root
+	if b.TxRoot != b.calculateTxRoot() {
+		return fmt.Errorf("invalid transaction root")
+	}
+
+	// Verify evidence root
+	if b.EvidenceRoot != b.calculateEvidenceRoot() {
+		return fmt.Errorf("invalid evidence root")
+	}
+
 	// Verify hash
 	expectedHash := b.calculateHash()
 	if b.Hash != expectedHash {
@@ -63,18 +158,8 @@ func (b *Block) Verify(publicKey []byte) error {
 	}
 
 	// Verify signature
-	if b.Signature == "" {
-		return fmt.Errorf("block not signed")
-	}
-
-	signature, err := crypto.SignatureFromHex(b.Signature)
-	if err != nil {
-		return fmt.Errorf("invalid signature: %w", err)
-	}
-
-	data := []byte(b.Hash)
-	if !crypto.Verify(publicKey, data, signature) {
-		return fmt.Errorf("invalid block signature")
+	if err := b.verifySignature(publicKey); err != nil {
+		return err
 	}
 
 	// Verify all transactions
@@ -89,6 +174,23 @@ func (b *Block) Verify(publicKey []byte) error {
 	return nil
 }
 
+// verifySignature checks the validator signature over the block header
+func (b *Block) verifySignature(publicKey []byte) error {
+	if b.Signature == "" {
+		return fmt.Errorf("block not signed")
+	}
+
+	signature, err := crypto.SignatureFromHex(b.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+
+	if !crypto.Verify(publicKey, b.EncodeHeader(), signature) {
+		return fmt.Errorf("invalid block signature")
+	}
+	return nil
+}
+
 // Serialize serializes block to bytes
 func (b *Block) Serialize() ([]byte, error) {
 	var buffer bytes.Buffer
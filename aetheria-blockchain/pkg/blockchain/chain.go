@@ -2,208 +2,842 @@ package blockchain
 
 import (
 	"fmt"
+	"log"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+	"github.com/aetheria/blockchain/pkg/events"
 )
 
 const (
-	// BlockReward is the reward for creating a block (in Aetheria tokens)
-	BlockReward = 50
 	// MinStakeAmount is the minimum amount required to become a validator
 	MinStakeAmount = 1000
 )
 
 // Blockchain represents the blockchain
 type Blockchain struct {
-	Blocks            []*Block
-	PendingTxs        []*Transaction
-	State             *State
-	GenesisAddress    string
-	mu                sync.RWMutex
-	txPool            map[string]*Transaction
+	blocks       []*Block // canonical chain by height; read through BlocksRange
+	state        *State   // post-state of the head; read through HeadState
+	Genesis      *Genesis
+	store        BlockStore
+	snapshots    *SnapshotStore
+	index        *chainIndex
+	forkChoice   ForkChoice
+	params       Params
+	rewards      RewardSchedule
+	tree         map[string]*blockNode   // every known block by hash, canonical or not
+	heights      map[uint64][]*blockNode // every known block by height
+	root         *blockNode              // oldest block forks may branch from
+	head         *blockNode              // tip of the canonical chain
+	cached       []*blockNode            // nodes currently holding a cached state
+	finalized    *blockNode              // newest final block
+	evidencePool map[string]*Evidence    // double-sign evidence waiting for inclusion
+	mempool      *Mempool                // unconfirmed transactions
+	events       *events.Bus             // chain and mempool notifications
+	mu           sync.RWMutex
 }
 
-// NewBlockchain creates a new blockchain with genesis block
-func NewBlockchain(genesisAddress string, initialSupply uint64) *Blockchain {
+// NewBlockchain opens a blockchain backed by store. If the store already
+// holds blocks the chain is reopened and its state rebuilt by replaying
+// them, starting from the newest usable snapshot when snapshots is non-nil,
+// and must descend from genesis; otherwise the genesis block is created from
+// genesis and persisted. Blocks are applied with the genesis parameters.
+// forkChoice selects between competing branches (nil means LongestChain),
+// rewards decides every coinbase amount (nil means the genesis monetary
+// policy), and mempool holds unconfirmed transactions (nil
+// means one with DefaultMempoolConfig). The chain and its mempool publish
+// on the bus returned by Events.
+func NewBlockchain(store BlockStore, snapshots *SnapshotStore, forkChoice ForkChoice, genesis *Genesis, rewards RewardSchedule, mempool *Mempool) (*Blockchain, error) {
+	if err := genesis.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid genesis: %w", err)
+	}
+	if forkChoice == nil {
+		forkChoice = LongestChain{}
+	}
+	if rewards == nil {
+		rewards = genesis.Params.Monetary
+	}
+	if mempool == nil {
+		mempool = NewMempool(DefaultMempoolConfig())
+	}
+
 	bc := &Blockchain{
-		Blocks:         make([]*Block, 0),
-		PendingTxs:     make([]*Transaction, 0),
-		State:          NewState(),
-		GenesisAddress: genesisAddress,
-		txPool:         make(map[string]*Transaction),
+		blocks:       make([]*Block, 0),
+		state:        NewState(),
+		Genesis:      genesis,
+		store:        store,
+		snapshots:    snapshots,
+		index:        newChainIndex(),
+		forkChoice:   forkChoice,
+		params:       genesis.Params,
+		rewards:      rewards,
+		tree:         make(map[string]*blockNode),
+		heights:      make(map[uint64][]*blockNode),
+		evidencePool: make(map[string]*Evidence),
+		mempool:      mempool,
+		events:       events.NewBus(),
+	}
+	mempool.events = bc.events
+
+	stored, err := store.Blocks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blocks: %w", err)
 	}
 
-	// Create genesis block
-	genesis := bc.createGenesisBlock(genesisAddress, initialSupply)
-	bc.Blocks = append(bc.Blocks, genesis)
-	bc.State.ApplyBlock(genesis)
+	if len(stored) == 0 {
+		// Create genesis block
+		state := bc.genesisState()
+		block := genesis.Block(state)
+		if err := store.Append(block); err != nil {
+			return nil, fmt.Errorf("failed to store genesis block: %w", err)
+		}
+		bc.setRoot([]*Block{block}, state)
+		return bc, nil
+	}
 
-	return bc
+	if err := bc.replay(stored); err != nil {
+		return nil, err
+	}
+	return bc, nil
 }
 
-// createGenesisBlock creates the first block in the chain
-func (bc *Blockchain) createGenesisBlock(address string, initialSupply uint64) *Block {
-	// Create coinbase transaction for initial supply
-	coinbase := &Transaction{
-		From:      "",
-		To:        address,
-		Amount:    initialSupply,
-		Fee:       0,
-		Timestamp: 0,
+// setRoot initializes the block tree with a canonical path ending at the
+// root block, whose post-state is state
+func (bc *Blockchain) setRoot(path []*Block, state *State) {
+	var parent *blockNode
+	for _, block := range path {
+		node := &blockNode{block: block, parent: parent}
+		bc.tree[block.Hash] = node
+		bc.heights[block.Index] = append(bc.heights[block.Index], node)
+		bc.blocks = append(bc.blocks, block)
+		bc.index.addBlock(block)
+		parent = node
 	}
-	coinbase.ID = coinbase.calculateID()
 
-	genesis := &Block{
-		Index:        0,
-		Timestamp:    0,
-		Transactions: []*Transaction{coinbase},
-		PrevHash:     "0",
-		Validator:    "genesis",
+	parent.state = state
+	bc.root = parent
+	bc.head = parent
+	bc.finalized = bc.tree[path[0].Hash]
+	bc.cached = []*blockNode{parent}
+	bc.state = state
+}
+
+// RebuildIndexes discards the hash, transaction and address indexes and
+// rebuilds them from the blocks in the block store
+func (bc *Blockchain) RebuildIndexes() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	blocks, err := bc.store.Blocks()
+	if err != nil {
+		return fmt.Errorf("failed to load blocks: %w", err)
 	}
-	genesis.Hash = genesis.calculateHash()
-	genesis.Signature = "genesis"
 
-	return genesis
+	index := newChainIndex()
+	indexed := make(map[string]bool)
+	for _, block := range blocks {
+		if block.Index >= uint64(len(bc.blocks)) || bc.blocks[block.Index].Hash != block.Hash || indexed[block.Hash] {
+			continue
+		}
+		index.addBlock(block)
+		indexed[block.Hash] = true
+	}
+	bc.index = index
+	return nil
+}
+
+// replay rebuilds the block tree, canonical chain and state from previously
+// stored blocks. With a usable snapshot, the snapshot block becomes the tree
+// root: blocks up to it are only link-checked, and branches forking below
+// it are ignored.
+func (bc *Blockchain) replay(blocks []*Block) error {
+	genesisState := bc.genesisState()
+	genesis := blocks[0]
+	if genesis.Index != 0 || genesis.Hash != bc.Genesis.Block(genesisState).Hash {
+		return fmt.Errorf("stored chain was not created from genesis %s", bc.Genesis.Hash())
+	}
+
+	byHash := make(map[string]*Block, len(blocks))
+	for _, block := range blocks {
+		byHash[block.Hash] = block
+	}
+
+	// Start from the newest snapshot that matches the stored chain
+	snap := bc.latestSnapshot(byHash)
+	if snap != nil {
+		path := make([]*Block, snap.Height+1)
+		block := byHash[snap.BlockHash]
+		for i := int(snap.Height); i >= 0; i-- {
+			if block == nil || block.Index != uint64(i) {
+				return fmt.Errorf("stored chain is missing block %d below snapshot", i)
+			}
+			path[i] = block
+			block = byHash[block.PrevHash]
+		}
+		for i := 1; i < len(path); i++ {
+			if err := bc.validateLink(path[i], path[i-1]); err != nil {
+				return fmt.Errorf("stored block %d is invalid: %w", path[i].Index, err)
+			}
+		}
+		snap.State.SetParams(bc.params)
+		snap.State.SetRewardSchedule(bc.rewards)
+		bc.setRoot(path, snap.State)
+	} else {
+		bc.setRoot([]*Block{genesis}, genesisState)
+	}
+
+	// Branches forking below the root, and every block on them, are dropped
+	dropped := make(map[string]bool)
+	for _, block := range blocks[1:] {
+		if node, known := bc.tree[block.Hash]; known {
+			// A block stored again carries the commit that made it final
+			if block.Commit != nil {
+				if err := bc.replayCommit(node, block.Commit); err != nil {
+					return fmt.Errorf("stored commit for block %d is invalid: %w", block.Index, err)
+				}
+			}
+			continue
+		}
+		if parent, ok := bc.tree[block.PrevHash]; dropped[block.PrevHash] || (ok && parent != bc.root && parent.block.Index <= bc.root.block.Index) {
+			dropped[block.Hash] = true
+			continue
+		}
+		node, err := bc.insertBlock(block)
+		if err != nil {
+			return fmt.Errorf("stored block %d is invalid: %w", block.Index, err)
+		}
+		bc.updateHead(node)
+	}
+
+	return nil
+}
+
+// latestSnapshot returns the newest valid snapshot of a final stored block.
+// The tree is rooted at the snapshot block, so a snapshot of a block later
+// orphaned would leave the canonical branch with no parent to attach to.
+func (bc *Blockchain) latestSnapshot(blocks map[string]*Block) *Snapshot {
+	if bc.snapshots == nil {
+		return nil
+	}
+	heights, err := bc.snapshots.List()
+	if err != nil {
+		log.Printf("Failed to list snapshots: %v", err)
+		return nil
+	}
+
+	for i := len(heights) - 1; i >= 0; i-- {
+		height := heights[i]
+		if height == 0 {
+			continue
+		}
+		snap, err := bc.snapshots.Load(height)
+		if err != nil {
+			log.Printf("Skipping snapshot at height %d: %v", height, err)
+			continue
+		}
+		if block, ok := blocks[snap.BlockHash]; !ok || block.Index != height {
+			log.Printf("Skipping snapshot at height %d: block not in store", height)
+			continue
+		}
+		if !finalStored(blocks, snap.BlockHash, height) {
+			log.Printf("Skipping snapshot at height %d: block is not final", height)
+			continue
+		}
+		return snap
+	}
+	return nil
+}
+
+// finalStored reports whether the stored block with hash at height is
+// final: the newest stored block with a commit is that block or descends
+// from it. Commits are trusted like the blocks below the snapshot.
+func finalStored(blocks map[string]*Block, hash string, height uint64) bool {
+	var final *Block
+	for _, block := range blocks {
+		if block.Commit != nil && (final == nil || block.Index > final.Index) {
+			final = block
+		}
+	}
+	for block := final; block != nil && block.Index >= height; block = blocks[block.PrevHash] {
+		if block.Index == height {
+			return block.Hash == hash
+		}
+	}
+	return false
+}
+
+// CreateSnapshot snapshots the state at the newest final block and saves
+// it. Blocks above it may still be reverted, so they are never snapshotted.
+func (bc *Blockchain) CreateSnapshot() (*Snapshot, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.saveSnapshot()
+}
+
+// saveSnapshot writes a snapshot of the newest final block; callers must
+// hold bc.mu
+func (bc *Blockchain) saveSnapshot() (*Snapshot, error) {
+	if bc.snapshots == nil {
+		return nil, fmt.Errorf("snapshots are not enabled")
+	}
+	final := bc.finalized
+	if final.block.Index == 0 {
+		return nil, fmt.Errorf("no block above genesis is final yet")
+	}
+	state, err := bc.stateOf(final)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := NewSnapshot(final.block.Index, final.block.Hash, state)
+	if err != nil {
+		return nil, err
+	}
+	if err := bc.snapshots.Save(snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// VerifySnapshot checks a snapshot against the chain by replaying every
+// block from genesis up to the snapshot height and comparing the result
+func (bc *Blockchain) VerifySnapshot(snap *Snapshot) error {
+	if err := snap.Verify(); err != nil {
+		return err
+	}
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if snap.Height >= uint64(len(bc.blocks)) {
+		return fmt.Errorf("snapshot height %d is beyond chain height %d", snap.Height, len(bc.blocks))
+	}
+	if bc.blocks[snap.Height].Hash != snap.BlockHash {
+		return fmt.Errorf("snapshot block hash does not match block %d", snap.Height)
+	}
+
+	state := bc.genesisState()
+	for _, block := range bc.blocks[1 : snap.Height+1] {
+		if _, err := state.ApplyBlock(block); err != nil {
+			return fmt.Errorf("failed to replay block %d: %w", block.Index, err)
+		}
+	}
+
+	replayed, err := NewSnapshot(snap.Height, snap.BlockHash, state)
+	if err != nil {
+		return err
+	}
+	if replayed.Checksum != snap.Checksum {
+		return fmt.Errorf("snapshot state does not match replayed state at height %d", snap.Height)
+	}
+	return nil
+}
+
+// Events returns the bus on which the chain publishes NewBlockEvent and
+// ReorgEvent and its mempool publishes TxAddedEvent and TxEvictedEvent.
+// Other components, such as the network node, may publish on it too.
+func (bc *Blockchain) Events() *events.Bus {
+	return bc.events
+}
+
+// ChainID returns the identifier of the network the chain belongs to
+func (bc *Blockchain) ChainID() string {
+	return bc.Genesis.ChainID
+}
+
+// checkChainID rejects a block, transaction or evidence signed for another
+// network; what names it in the error
+func (bc *Blockchain) checkChainID(what, chainID string) error {
+	if chainID != bc.Genesis.ChainID {
+		return fmt.Errorf("%s is signed for chain %q, this node is on chain %q", what, chainID, bc.Genesis.ChainID)
+	}
+	return nil
+}
+
+// genesisState returns the state before the first block, using the chain's
+// reward schedule
+func (bc *Blockchain) genesisState() *State {
+	state := bc.Genesis.State()
+	state.SetRewardSchedule(bc.rewards)
+	return state
 }
 
 // GetLatestBlock returns the last block in the chain
 func (bc *Blockchain) GetLatestBlock() *Block {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
-	
-	if len(bc.Blocks) == 0 {
+	return bc.latestBlock()
+}
+
+// HeadState returns the post-state of the head block. A head change
+// replaces the state rather than modifying it, so the result stays
+// consistent while blocks are added.
+func (bc *Blockchain) HeadState() *State {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.state
+}
+
+// latestBlock returns the tip; callers must hold bc.mu
+func (bc *Blockchain) latestBlock() *Block {
+	if len(bc.blocks) == 0 {
 		return nil
 	}
-	return bc.Blocks[len(bc.Blocks)-1]
+	return bc.blocks[len(bc.blocks)-1]
 }
 
-// AddBlock adds a new block to the chain
+// AddBlock adds a block to the block tree. A block extending any known
+// branch is accepted; the canonical chain switches to its branch when the
+// fork choice rule prefers it, and transactions from orphaned blocks are
+// returned to the pool. A commit carried by the block, as sent to a syncing
+// peer, is checked separately: an invalid one is logged and dropped.
 func (bc *Blockchain) AddBlock(block *Block) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	// Validate block
-	if err := bc.validateBlock(block); err != nil {
+	commit := block.Commit
+	if node, known := bc.tree[block.Hash]; known && commit != nil && node.block.Commit == nil {
+		return bc.addCommit(commit)
+	}
+
+	// Validate block and compute the resulting state
+	node, err := bc.insertBlock(block)
+	if err != nil {
 		return fmt.Errorf("invalid block: %w", err)
 	}
 
-	// Apply block to state
-	tempState := bc.State.Clone()
-	if err := tempState.ApplyBlock(block); err != nil {
-		return fmt.Errorf("failed to apply block: %w", err)
+	// Persist before exposing the block in memory; the commit is stored
+	// once verified
+	block.Commit = nil
+	if err := bc.store.Append(block); err != nil {
+		bc.removeNode(node)
+		return fmt.Errorf("failed to store block: %w", err)
+	}
+
+	bc.headChanged(bc.updateHead(node))
+
+	if commit != nil {
+		if err := bc.addCommit(commit); err != nil {
+			log.Printf("Ignoring commit for block %d: %v", block.Index, err)
+		}
+	}
+	return nil
+}
+
+// headChanged publishes a change of the canonical chain, returns orphaned
+// transactions and evidence to the pools and snapshots the new head when
+// due; callers must hold bc.mu
+func (bc *Blockchain) headChanged(orphaned, adopted []*Block) {
+	if len(adopted) == 0 {
+		return
+	}
+
+	if len(orphaned) > 0 {
+		bc.events.Publish(ReorgEvent{
+			Ancestor: adopted[0].Index - 1,
+			Orphaned: orphaned,
+			Adopted:  adopted,
+		})
+	}
+	for _, block := range adopted {
+		bc.events.Publish(NewBlockEvent{Block: block})
 	}
 
-	// Add block to chain
-	bc.Blocks = append(bc.Blocks, block)
-	bc.State = tempState
+	// Return transactions and evidence from orphaned blocks to the pools,
+	// oldest first
+	for i := len(orphaned) - 1; i >= 0; i-- {
+		for _, ev := range orphaned[i].Evidence {
+			bc.evidencePool[ev.ID()] = ev
+		}
+		for _, tx := range orphaned[i].Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			if _, mined := bc.index.txLocation(tx.ID); mined {
+				continue
+			}
+			if err := bc.mempool.Add(tx, bc.state); err != nil {
+				log.Printf("Dropping orphaned transaction %s: %v", tx.ID, err)
+			}
+		}
+	}
 
-	// Remove transactions from pool
+	// Drop pooled transactions the new head has mined or made stale; the
+	// rest stay pooled for later blocks
+	for _, tx := range bc.mempool.Reset(bc.state) {
+		if _, mined := bc.index.txLocation(tx.ID); !mined {
+			bc.events.Publish(TxEvictedEvent{Tx: tx, Reason: EvictStale})
+		}
+	}
+	bc.pruneEvidence()
+}
+
+// validateBlock validates a block on top of parent. The block is applied to
+// a copy of parentState, and the resulting state and receipts are returned
+// once their roots match the block's StateRoot and ReceiptsRoot.
+func (bc *Blockchain) validateBlock(block *Block, parent *Block, parentState *State) (*State, []*Receipt, error) {
+	if err := bc.validateLink(block, parent); err != nil {
+		return nil, nil, err
+	}
+	if err := bc.params.checkBlockLimits(block); err != nil {
+		return nil, nil, err
+	}
+	if err := bc.checkProposer(block, parent, parentState); err != nil {
+		return nil, nil, err
+	}
+
+	// Verify all transactions and evidence
 	for _, tx := range block.Transactions {
-		delete(bc.txPool, tx.ID)
+		if err := bc.checkChainID("transaction "+tx.ID, tx.ChainID); err != nil {
+			return nil, nil, err
+		}
+		if !tx.IsCoinbase() {
+			if err := tx.Verify(); err != nil {
+				return nil, nil, fmt.Errorf("invalid transaction %s: %w", tx.ID, err)
+			}
+		}
+	}
+	for _, ev := range block.Evidence {
+		if err := bc.checkChainID("evidence "+ev.ID(), ev.ChainID()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Apply block to a copy of the state
+	state := parentState.Clone()
+	receipts, err := state.ApplyBlock(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply block: %w", err)
 	}
 
-	// Remove from pending
-	bc.PendingTxs = make([]*Transaction, 0)
+	// Check state root
+	if root := state.Root(); block.StateRoot != root {
+		return nil, nil, fmt.Errorf("invalid state root: expected %s, got %s", root, block.StateRoot)
+	}
 
-	return nil
+	// Check receipts root
+	if root := ReceiptsRoot(receipts); block.ReceiptsRoot != root {
+		return nil, nil, fmt.Errorf("invalid receipts root: expected %s, got %s", root, block.ReceiptsRoot)
+	}
+
+	// Check the validator set elected by an epoch's first block
+	if hash := state.headerValidatorSetHash(block.Index); block.ValidatorSetHash != hash {
+		return nil, nil, fmt.Errorf("invalid validator set hash: expected %q, got %q", hash, block.ValidatorSetHash)
+	}
+
+	return state, receipts, nil
+}
+
+// checkProposer checks that a block is timed at the start of a slot later
+// than its parent's, and that it was proposed and signed by the validator
+// parentState elects to lead that slot
+func (bc *Blockchain) checkProposer(block *Block, parent *Block, parentState *State) error {
+	genesisTime := bc.Genesis.GenesisTime
+	slot := bc.params.Slot(genesisTime, block.Timestamp)
+	if block.Timestamp != bc.params.SlotTime(genesisTime, slot) {
+		return fmt.Errorf("block timestamp %d is not the start of a slot", block.Timestamp)
+	}
+	if parentSlot := bc.params.Slot(genesisTime, parent.Timestamp); slot <= parentSlot {
+		return fmt.Errorf("block slot %d is not after its parent's slot %d", slot, parentSlot)
+	}
+
+	leader, err := parentState.slotLeader(slot)
+	if err != nil {
+		return err
+	}
+	if block.Validator != leader.Address {
+		return fmt.Errorf("validator %s is not the leader of slot %d, %s is", block.Validator, slot, leader.Address)
+	}
+
+	publicKey, err := crypto.PublicKeyFromHex(leader.PublicKey)
+	if err != nil {
+		return fmt.Errorf("slot leader %s has an invalid key: %w", leader.Address, err)
+	}
+	return block.verifySignature(publicKey)
 }
 
-// validateBlock validates a block before adding it to the chain
-func (bc *Blockchain) validateBlock(block *Block) error {
-	latest := bc.GetLatestBlock()
-	
+// validateLink checks that a block correctly extends parent
+func (bc *Blockchain) validateLink(block *Block, parent *Block) error {
+	// Check chain ID
+	if err := bc.checkChainID("block", block.ChainID); err != nil {
+		return err
+	}
+
 	// Check index
-	if block.Index != latest.Index+1 {
-		return fmt.Errorf("invalid block index: expected %d, got %d", latest.Index+1, block.Index)
+	if block.Index != parent.Index+1 {
+		return fmt.Errorf("invalid block index: expected %d, got %d", parent.Index+1, block.Index)
 	}
 
 	// Check previous hash
-	if block.PrevHash != latest.Hash {
+	if block.PrevHash != parent.Hash {
 		return fmt.Errorf("invalid previous hash")
 	}
 
+	// Check transaction root
+	if block.TxRoot != block.calculateTxRoot() {
+		return fmt.Errorf("invalid transaction root")
+	}
+
+	// Check evidence root
+	if block.EvidenceRoot != block.calculateEvidenceRoot() {
+		return fmt.Errorf("invalid evidence root")
+	}
+
 	// Check hash
 	expectedHash := block.calculateHash()
 	if block.Hash != expectedHash {
 		return fmt.Errorf("invalid block hash")
 	}
 
-	// Verify all transactions
-	for _, tx := range block.Transactions {
-		if !tx.IsCoinbase() {
-			if err := tx.Verify(); err != nil {
-				return fmt.Errorf("invalid transaction %s: %w", tx.ID, err)
-			}
-		}
-	}
-
 	return nil
 }
 
-// AddTransaction adds a transaction to the pending pool
+// AddTransaction verifies a transaction and adds it to the mempool.
+// Transactions whose nonce is ahead of the sender's next expected nonce are
+// queued until the gap is filled.
 func (bc *Blockchain) AddTransaction(tx *Transaction) error {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
-
-	// Verify transaction
+	if err := bc.checkChainID("transaction", tx.ChainID); err != nil {
+		return err
+	}
 	if err := tx.Verify(); err != nil {
 		return fmt.Errorf("invalid transaction: %w", err)
 	}
 
-	// Check if transaction already exists
-	if _, exists := bc.txPool[tx.ID]; exists {
-		return fmt.Errorf("transaction already exists")
-	}
-
-	// Check balance
-	balance := bc.State.GetBalance(tx.From)
-	totalRequired := tx.Amount + tx.Fee
-	if balance < totalRequired {
-		return fmt.Errorf("insufficient balance: has %d, needs %d", balance, totalRequired)
-	}
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.mempool.Add(tx, bc.state)
+}
 
-	// Add to pool
-	bc.txPool[tx.ID] = tx
-	bc.PendingTxs = append(bc.PendingTxs, tx)
+// NextNonce returns the nonce a new transaction from address should use,
+// accounting for transactions already pending in the mempool
+func (bc *Blockchain) NextNonce(address string) uint64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.mempool.NextNonce(address, bc.state)
+}
 
-	return nil
+// PendingTransactions returns the mempool transactions executable on top
+// of the current head, in the order a block producer would include them
+func (bc *Blockchain) PendingTransactions() []*Transaction {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.mempool.Pending(bc.state)
 }
 
-// CreateBlock creates a new block with pending transactions
-func (bc *Blockchain) CreateBlock(validator string) *Block {
+// CreateBlock creates a new block with pending transactions, proposed by
+// validator in slot. privateKey is the validator's key, from which its
+// beacon secrets are derived; the block is not signed.
+func (bc *Blockchain) CreateBlock(validator string, slot uint64, privateKey []byte) *Block {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
-	latest := bc.GetLatestBlock()
-	
+	latest := bc.latestBlock()
+
 	// Create coinbase transaction for block reward
 	coinbase := &Transaction{
+		ChainID:   bc.Genesis.ChainID,
 		From:      "",
 		To:        validator,
-		Amount:    BlockReward,
+		Amount:    bc.rewards.CalculateReward(latest.Index+1, bc.state.GetSupply()),
 		Fee:       0,
-		Timestamp: 0,
+		Nonce:     latest.Index + 1,
+		Timestamp: time.Now().Unix(),
 	}
 	coinbase.ID = coinbase.calculateID()
 
-	// Add pending transactions
+	trial := bc.state.Clone()
+	trial.beginBlock(latest.Index + 1)
+	reveal, commit := bc.state.randaoContribution(validator, privateKey, bc.Genesis.ChainID, latest.Index+1)
+
+	// Header roots are fixed-length hashes, so the header's size is known
+	// before its contents are chosen
+	maxBytes := bc.params.MaxBlockBytes
+	empty := NewBlock(bc.Genesis.ChainID, latest.Index+1, []*Transaction{coinbase}, nil, latest.Hash, validator, latest.StateRoot, ReceiptsRoot(nil), trial.headerValidatorSetHash(latest.Index+1))
+	empty.RandaoReveal = reveal
+	empty.RandaoCommit = commit
+	size := uint64(empty.Size())
+	fits := func(n int) bool {
+		return maxBytes == 0 || size+uint64(n) <= maxBytes
+	}
+
+	// Add pending evidence that still applies
+	evidence := make([]*Evidence, 0)
+	for _, ev := range bc.pendingEvidence() {
+		n := len(ev.Encode())
+		if !fits(n) {
+			continue
+		}
+		if _, err := trial.ApplyEvidence(ev, validator); err != nil {
+			continue
+		}
+		evidence = append(evidence, ev)
+		size += uint64(n)
+	}
+
+	// Fill the block greedily with pending transactions that are still valid,
+	// highest fee per byte first, skipping ones that do not fit. A valid
+	// transaction that fails to execute is included and pays its fee.
 	transactions := []*Transaction{coinbase}
-	transactions = append(transactions, bc.PendingTxs...)
+	for _, tx := range bc.mempool.Pending(bc.state) {
+		if bc.params.MaxBlockTxs > 0 && uint64(len(transactions)) >= bc.params.MaxBlockTxs {
+			break
+		}
+		n := tx.Size()
+		if !fits(n) {
+			continue
+		}
+		if _, err := trial.ApplyTransaction(tx); err != nil {
+			continue
+		}
+		transactions = append(transactions, tx)
+		size += uint64(n)
+	}
+
+	// Compute the resulting state and receipts roots and, at an epoch start,
+	// the elected validator set
+	block := &Block{Index: latest.Index + 1, Transactions: transactions, Evidence: evidence, Validator: validator, RandaoReveal: reveal, RandaoCommit: commit}
+	state := bc.state.Clone()
+	receipts, err := state.ApplyBlock(block)
+	if err != nil {
+		// Every transaction applied above, so this cannot fail
+		log.Printf("Failed to apply new block: %v", err)
+	}
 
 	// Create block
-	block := NewBlock(latest.Index+1, transactions, latest.Hash, validator)
-	
+	block = NewBlock(bc.Genesis.ChainID, latest.Index+1, transactions, evidence, latest.Hash, validator, state.Root(), ReceiptsRoot(receipts), state.headerValidatorSetHash(block.Index))
+
+	// The block is timed at the start of its slot and carries the
+	// validator's contribution to the beacon
+	block.Timestamp = bc.params.SlotTime(bc.Genesis.GenesisTime, slot)
+	block.RandaoReveal = reveal
+	block.RandaoCommit = commit
+	block.Hash = block.calculateHash()
+
 	return block
 }
 
+// AddEvidence adds double-sign evidence to the evidence pool so that the
+// next block produced includes it
+func (bc *Blockchain) AddEvidence(ev *Evidence) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if err := bc.checkChainID("evidence", ev.ChainID()); err != nil {
+		return err
+	}
+	id := ev.ID()
+	if _, exists := bc.evidencePool[id]; exists {
+		return fmt.Errorf("evidence already known")
+	}
+	if err := bc.state.CheckEvidence(ev); err != nil {
+		return fmt.Errorf("invalid evidence: %w", err)
+	}
+
+	bc.evidencePool[id] = ev
+	return nil
+}
+
+// PendingEvidence returns the evidence waiting to be included, ordered by ID
+func (bc *Blockchain) PendingEvidence() []*Evidence {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.pendingEvidence()
+}
+
+// pendingEvidence returns pooled evidence ordered by ID; callers must hold
+// bc.mu
+func (bc *Blockchain) pendingEvidence() []*Evidence {
+	ids := make([]string, 0, len(bc.evidencePool))
+	for id := range bc.evidencePool {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	evidence := make([]*Evidence, len(ids))
+	for i, id := range ids {
+		evidence[i] = bc.evidencePool[id]
+	}
+	return evidence
+}
+
+// pruneEvidence drops pooled evidence that no longer applies to the head
+// state, such as evidence already included; callers must hold bc.mu
+func (bc *Blockchain) pruneEvidence() {
+	for id, ev := range bc.evidencePool {
+		if err := bc.state.CheckEvidence(ev); err != nil {
+			delete(bc.evidencePool, id)
+		}
+	}
+}
+
+// DetectDoubleSign returns evidence if a known block at the same height and
+// in the same slot was signed by the same validator as block, or nil. The
+// caller must already have verified block's signature.
+func (bc *Blockchain) DetectDoubleSign(block *Block) *Evidence {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	for _, node := range bc.heights[block.Index] {
+		known := node.block
+		if known.Validator == block.Validator && known.Timestamp == block.Timestamp && known.Hash != block.Hash {
+			return NewEvidence(known, block)
+		}
+	}
+	return nil
+}
+
 // GetBlock returns a block by index
 func (bc *Blockchain) GetBlock(index uint64) *Block {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	if index >= uint64(len(bc.Blocks)) {
+	if index >= uint64(len(bc.blocks)) {
 		return nil
 	}
-	return bc.Blocks[index]
+	return bc.blocks[index]
+}
+
+// BlocksRange returns a copy of up to limit canonical blocks starting at
+// index from, or of all of them from there when limit is 0
+func (bc *Blockchain) BlocksRange(from uint64, limit int) []*Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if from >= uint64(len(bc.blocks)) {
+		return []*Block{}
+	}
+	blocks := bc.blocks[from:]
+	if limit > 0 && limit < len(blocks) {
+		blocks = blocks[:limit]
+	}
+	return append([]*Block(nil), blocks...)
+}
+
+// GetKnownBlock returns any block in the block tree by hash, including
+// blocks on non-canonical branches
+func (bc *Blockchain) GetKnownBlock(hash string) *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if node, ok := bc.tree[hash]; ok {
+		return node.block
+	}
+	return nil
+}
+
+// Extends reports whether the known block with hash is the block with hash
+// ancestor or descends from it
+func (bc *Blockchain) Extends(hash, ancestor string) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	node, ok := bc.tree[hash]
+	if !ok {
+		return false
+	}
+	ancestorNode, ok := bc.tree[ancestor]
+	return ok && extends(node, ancestorNode)
 }
 
 // GetBlockByHash returns a block by hash
@@ -211,12 +845,11 @@ func (bc *Blockchain) GetBlockByHash(hash string) *Block {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	for _, block := range bc.Blocks {
-		if block.Hash == hash {
-			return block
-		}
+	height, ok := bc.index.blockHeight(hash)
+	if !ok {
+		return nil
 	}
-	return nil
+	return bc.blocks[height]
 }
 
 // GetTransaction returns a transaction by ID
@@ -225,25 +858,142 @@ func (bc *Blockchain) GetTransaction(txID string) *Transaction {
 	defer bc.mu.RUnlock()
 
 	// Check in blocks
-	for _, block := range bc.Blocks {
-		if tx := block.GetTransactionByID(txID); tx != nil {
-			return tx
-		}
+	if loc, ok := bc.index.txLocation(txID); ok {
+		return bc.blocks[loc.Height].Transactions[loc.Position]
 	}
 
-	// Check in pool
-	if tx, exists := bc.txPool[txID]; exists {
+	// Check in mempool
+	if tx, exists := bc.mempool.Get(txID); exists {
 		return tx
 	}
 
 	return nil
 }
 
+// GetTransactionLocation returns the block height and position of a mined transaction
+func (bc *Blockchain) GetTransactionLocation(txID string) (TxLocation, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.index.txLocation(txID)
+}
+
+// GetAddressTransactions returns up to limit mined transactions sent or
+// received by address, oldest first, skipping the first offset entries.
+// It also returns the total number of transactions for the address.
+func (bc *Blockchain) GetAddressTransactions(address string, offset, limit int) ([]*Transaction, int) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	ids := bc.index.addressHistory(address)
+	total := len(ids)
+	if offset >= total {
+		return []*Transaction{}, total
+	}
+	ids = ids[offset:]
+	if limit > 0 && limit < len(ids) {
+		ids = ids[:limit]
+	}
+
+	txs := make([]*Transaction, 0, len(ids))
+	for _, id := range ids {
+		loc, _ := bc.index.txLocation(id)
+		txs = append(txs, bc.blocks[loc.Height].Transactions[loc.Position])
+	}
+	return txs, total
+}
+
+// GetTransactionProof returns a Merkle proof that a mined transaction is
+// included in its block
+func (bc *Blockchain) GetTransactionProof(txID string) (*TxProof, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	loc, ok := bc.index.txLocation(txID)
+	if !ok {
+		return nil, fmt.Errorf("transaction not found in chain")
+	}
+	return NewTxProof(bc.blocks[loc.Height], loc.Position)
+}
+
+// GetReceipt returns the receipt of a mined transaction, as recorded when
+// its block was applied. Blocks up to the snapshot the chain was opened from
+// were never applied here, so their receipts are recomputed by replaying the
+// chain.
+func (bc *Blockchain) GetReceipt(txID string) (*Receipt, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	loc, ok := bc.index.txLocation(txID)
+	if !ok {
+		return nil, fmt.Errorf("transaction not found in chain")
+	}
+	if node := bc.tree[bc.blocks[loc.Height].Hash]; node.receipts != nil {
+		return node.receipts[loc.Position], nil
+	}
+
+	parent, err := bc.stateAt(loc.Height - 1)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := parent.Clone().ApplyBlock(bc.blocks[loc.Height])
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay block %d: %w", loc.Height, err)
+	}
+	return receipts[loc.Position], nil
+}
+
+// GetAccountProof returns a proof of an address's account against the state
+// root of the block at height
+func (bc *Blockchain) GetAccountProof(address string, height uint64) (*AccountProof, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if height >= uint64(len(bc.blocks)) {
+		return nil, fmt.Errorf("block %d not found", height)
+	}
+	block := bc.blocks[height]
+
+	state, err := bc.stateAt(height)
+	if err != nil {
+		return nil, err
+	}
+	account, proof := state.ProveAccount(address)
+
+	return &AccountProof{
+		Address:    address,
+		Account:    account,
+		BlockIndex: block.Index,
+		BlockHash:  block.Hash,
+		StateRoot:  block.StateRoot,
+		Proof:      proof,
+	}, nil
+}
+
+// stateAt returns the state after the canonical block at height, replaying
+// from the nearest ancestor with a cached state, or from genesis when no
+// ancestor has one; callers must hold bc.mu
+func (bc *Blockchain) stateAt(height uint64) (*State, error) {
+	node := bc.tree[bc.blocks[height].Hash]
+	for ancestor := node; ancestor != nil; ancestor = ancestor.parent {
+		if ancestor.state != nil {
+			return bc.stateOf(node)
+		}
+	}
+
+	state := bc.genesisState()
+	for _, block := range bc.blocks[1 : height+1] {
+		if _, err := state.ApplyBlock(block); err != nil {
+			return nil, fmt.Errorf("failed to replay block %d: %w", block.Index, err)
+		}
+	}
+	return state, nil
+}
+
 // Height returns the current blockchain height
 func (bc *Blockchain) Height() uint64 {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
-	return uint64(len(bc.Blocks))
+	return uint64(len(bc.blocks))
 }
 
 // IsValid validates the entire blockchain
@@ -251,15 +1001,25 @@ func (bc *Blockchain) IsValid() bool {
 	bc.mu.RLock()
 	defer bc.mu.RUnlock()
 
-	for i := 1; i < len(bc.Blocks); i++ {
-		currentBlock := bc.Blocks[i]
-		prevBlock := bc.Blocks[i-1]
+	for i := 1; i < len(bc.blocks); i++ {
+		currentBlock := bc.blocks[i]
+		prevBlock := bc.blocks[i-1]
 
 		// Check hash
 		if currentBlock.Hash != currentBlock.calculateHash() {
 			return false
 		}
 
+		// Check transaction root
+		if currentBlock.TxRoot != currentBlock.calculateTxRoot() {
+			return false
+		}
+
+		// Check evidence root
+		if currentBlock.EvidenceRoot != currentBlock.calculateEvidenceRoot() {
+			return false
+		}
+
 		// Check previous hash
 		if currentBlock.PrevHash != prevBlock.Hash {
 			return false
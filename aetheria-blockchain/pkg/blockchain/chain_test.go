@@ -0,0 +1,135 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+const testChainID = "aetheria-test"
+
+// newTestKeys creates n key pairs
+func newTestKeys(t *testing.T, n int) []*crypto.KeyPair {
+	t.Helper()
+	keys := make([]*crypto.KeyPair, n)
+	for i := range keys {
+		keyPair, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = keyPair
+	}
+	return keys
+}
+
+// newTestGenesis funds every key and makes it a validator with the minimum
+// stake
+func newTestGenesis(keys []*crypto.KeyPair) *Genesis {
+	genesis := NewGenesis(testChainID, 0)
+	for _, keyPair := range keys {
+		genesis.Allocations = append(genesis.Allocations, GenesisAllocation{Address: keyPair.Address(), Balance: 1000000})
+		genesis.Validators = append(genesis.Validators, GenesisValidator{
+			Address:   keyPair.Address(),
+			PublicKey: crypto.PublicKeyToHex(keyPair.PublicKey),
+			Stake:     MinStakeAmount,
+		})
+	}
+	return genesis
+}
+
+// newTestChain opens a chain on store, with the default fork choice and
+// reward schedule
+func newTestChain(t *testing.T, genesis *Genesis, store BlockStore, snapshots *SnapshotStore) *Blockchain {
+	t.Helper()
+	bc, err := NewBlockchain(store, snapshots, nil, genesis, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+// nextBlock creates and signs a block on the head for the first slot after
+// it led by one of keys, passing over skip such slots, without adding it
+func nextBlock(t *testing.T, bc *Blockchain, keys []*crypto.KeyPair, skip int) *Block {
+	t.Helper()
+	byAddress := make(map[string]*crypto.KeyPair, len(keys))
+	for _, keyPair := range keys {
+		byAddress[keyPair.Address()] = keyPair
+	}
+
+	state := bc.HeadState()
+	slot := bc.params.Slot(bc.Genesis.GenesisTime, bc.GetLatestBlock().Timestamp)
+	for tries := 0; tries < 10000; tries++ {
+		slot++
+		leader, err := state.SlotLeader(slot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyPair, ok := byAddress[leader]
+		if !ok {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		block := bc.CreateBlock(keyPair.Address(), slot, keyPair.PrivateKey)
+		if err := block.Sign(keyPair.PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+		return block
+	}
+	t.Fatal("no slot led by the given keys")
+	return nil
+}
+
+// mineBlock adds the next block on the head, produced by one of keys
+func mineBlock(t *testing.T, bc *Blockchain, keys []*crypto.KeyPair) *Block {
+	t.Helper()
+	block := nextBlock(t, bc, keys, 0)
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+// commitBlock makes block final with precommits by keys
+func commitBlock(t *testing.T, bc *Blockchain, block *Block, keys []*crypto.KeyPair) {
+	t.Helper()
+	precommits := make([]*Vote, 0, len(keys))
+	for _, keyPair := range keys {
+		vote := NewVote(bc.ChainID(), VotePrecommit, block.Index, 0, block.Hash, keyPair.Address())
+		if err := vote.Sign(keyPair.PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+		precommits = append(precommits, vote)
+	}
+	if err := bc.AddCommit(NewCommit(block.Index, 0, block.Hash, precommits)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlocksRangeCopies(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	bc := newTestChain(t, newTestGenesis(keys), NewMemoryBlockStore(), nil)
+	for i := 0; i < 3; i++ {
+		mineBlock(t, bc, keys)
+	}
+
+	if blocks := bc.BlocksRange(0, 0); len(blocks) != 4 {
+		t.Fatalf("expected all 4 blocks, got %d", len(blocks))
+	}
+	blocks := bc.BlocksRange(1, 2)
+	if len(blocks) != 2 || blocks[0].Index != 1 || blocks[1].Index != 2 {
+		t.Fatalf("expected blocks 1 and 2, got %d blocks", len(blocks))
+	}
+	if blocks := bc.BlocksRange(4, 1); len(blocks) != 0 {
+		t.Fatalf("expected no blocks past the head, got %d", len(blocks))
+	}
+
+	// Changing the returned slice leaves the chain alone
+	blocks[0] = nil
+	if bc.GetBlock(1) == nil {
+		t.Fatal("BlocksRange returned the chain's own slice")
+	}
+}
@@ -0,0 +1,180 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// BasisPoints is the denominator for commission rates and slash fractions
+const BasisPoints = 10000
+
+// Delegation is stake an address has bonded to a validator
+type Delegation struct {
+	Validator string `json:"validator"`
+	Amount    uint64 `json:"amount"`
+}
+
+// mulDiv returns a*b/c without overflowing the intermediate product; the
+// result must fit in a uint64
+func mulDiv(a, b, c uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	quo, _ := bits.Div64(hi, lo, c)
+	return quo
+}
+
+// GetDelegations returns the delegations made by an address, sorted by
+// validator
+func (s *State) GetDelegations(delegator string) []Delegation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.delegations(delegator)
+}
+
+// delegations returns sorted delegations; callers must hold s.mu
+func (s *State) delegations(delegator string) []Delegation {
+	delegations := make([]Delegation, 0, len(s.Delegations[delegator]))
+	for validator, amount := range s.Delegations[delegator] {
+		delegations = append(delegations, Delegation{Validator: validator, Amount: amount})
+	}
+	sort.Slice(delegations, func(i, j int) bool {
+		return delegations[i].Validator < delegations[j].Validator
+	})
+	return delegations
+}
+
+// GetDelegated returns the total stake delegated to a validator
+func (s *State) GetDelegated(validator string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.delegated(validator)
+}
+
+// delegated sums delegations to a validator; callers must hold s.mu
+func (s *State) delegated(validator string) uint64 {
+	var total uint64
+	for _, delegations := range s.Delegations {
+		total += delegations[validator]
+	}
+	return total
+}
+
+// GetPower returns a validator's voting power: its own stake plus the stake
+// delegated to it
+func (s *State) GetPower(validator string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Stakes[validator] + s.delegated(validator)
+}
+
+// GetCommission returns a validator's commission rate in basis points
+func (s *State) GetCommission(validator string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Commissions[validator]
+}
+
+// applyDelegate bonds stake from the sender's balance to a validator;
+// callers must hold s.mu
+func (s *State) applyDelegate(tx *Transaction) error {
+	if tx.Amount == 0 {
+		return fmt.Errorf("delegation amount must be positive")
+	}
+	if tx.To == tx.From {
+		return fmt.Errorf("cannot delegate to self, stake instead")
+	}
+	if s.Stakes[tx.To] == 0 || s.ValidatorKeys[tx.To] == "" {
+		return fmt.Errorf("%s is not a validator", tx.To)
+	}
+	if s.Tombstoned[tx.To] {
+		return fmt.Errorf("validator %s is tombstoned", tx.To)
+	}
+
+	s.Balances[tx.From] -= tx.Amount + tx.Fee
+	if s.Delegations[tx.From] == nil {
+		s.Delegations[tx.From] = make(map[string]uint64)
+	}
+	s.Delegations[tx.From][tx.To] += tx.Amount
+	return nil
+}
+
+// applyUndelegate moves part of a delegation into the sender's unbonding
+// queue; callers must hold s.mu
+func (s *State) applyUndelegate(tx *Transaction) error {
+	if tx.Amount == 0 {
+		return fmt.Errorf("undelegation amount must be positive")
+	}
+	delegated := s.Delegations[tx.From][tx.To]
+	if delegated < tx.Amount {
+		return fmt.Errorf("insufficient delegation to %s: has %d, needs %d", tx.To, delegated, tx.Amount)
+	}
+
+	s.Balances[tx.From] -= tx.Fee
+	s.removeDelegation(tx.From, tx.To, tx.Amount)
+	s.addUnbonding(tx.From, tx.To, tx.Amount)
+	return nil
+}
+
+// applySetCommission sets the sender's commission rate; callers must hold s.mu
+func (s *State) applySetCommission(tx *Transaction) error {
+	if tx.Amount > BasisPoints {
+		return fmt.Errorf("commission %d exceeds %d basis points", tx.Amount, BasisPoints)
+	}
+
+	s.Balances[tx.From] -= tx.Fee
+	if tx.Amount == 0 {
+		delete(s.Commissions, tx.From)
+	} else {
+		s.Commissions[tx.From] = tx.Amount
+	}
+	return nil
+}
+
+// removeDelegation reduces a delegation, dropping it once empty; callers
+// must hold s.mu
+func (s *State) removeDelegation(delegator, validator string, amount uint64) {
+	s.Delegations[delegator][validator] -= amount
+	if s.Delegations[delegator][validator] == 0 {
+		delete(s.Delegations[delegator], validator)
+	}
+	if len(s.Delegations[delegator]) == 0 {
+		delete(s.Delegations, delegator)
+	}
+	s.touch(delegator)
+}
+
+// payDelegators shares a validator's block rewards, already credited to the
+// validator, with its delegators. The validator keeps its commission and the
+// share earned by its own stake; rounding remainders stay with the
+// validator. It returns a reward event per delegator paid, sorted by
+// delegator.
+func (s *State) payDelegators(validator string, rewards uint64) []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	power := s.Stakes[validator] + s.delegated(validator)
+	if rewards == 0 || power == 0 {
+		return nil
+	}
+
+	var events []Event
+	pool := rewards - mulDiv(rewards, s.Commissions[validator], BasisPoints)
+	for delegator, delegations := range s.Delegations {
+		amount := delegations[validator]
+		if amount == 0 {
+			continue
+		}
+		share := mulDiv(pool, amount, power)
+		s.Balances[validator] -= share
+		s.Balances[delegator] += share
+		if share > 0 {
+			s.touch(validator)
+			s.touch(delegator)
+			events = append(events, Event{Type: EventReward, From: validator, To: delegator, Amount: share})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].To < events[j].To
+	})
+	return events
+}
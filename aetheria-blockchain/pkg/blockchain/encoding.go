@@ -0,0 +1,237 @@
+package blockchain
+
+import (
+	"sort"
+
+	"github.com/aetheria/blockchain/pkg/codec"
+	"github.com/aetheria/blockchain/pkg/monetary"
+)
+
+// EncodingVersion is the version byte leading every canonical encoding.
+// It changes whenever the layout of an encoded structure changes: version 2
+// added receipts, votes, validator sets, assets, HTLCs and the header and
+// genesis fields that commit to them.
+const EncodingVersion = 2
+
+// Kinds distinguish the structures sharing the canonical encoding, so a
+// preimage of one kind can never be reinterpreted as another
+const (
+	kindTransaction  uint8 = 0x01
+	kindBlockHeader  uint8 = 0x02
+	kindEvidence     uint8 = 0x03
+	kindGenesis      uint8 = 0x04
+	kindReceipt      uint8 = 0x05
+	kindVote         uint8 = 0x06
+	kindValidatorSet uint8 = 0x07
+)
+
+// EncodeBody returns the canonical encoding of the transaction's signed
+// fields. The transaction ID is its SHA-256 hash and the signature covers it.
+func (tx *Transaction) EncodeBody() []byte {
+	enc := codec.NewEncoder()
+	enc.WriteUint8(EncodingVersion)
+	enc.WriteUint8(kindTransaction)
+	enc.WriteString(tx.ChainID)
+	enc.WriteUint8(uint8(tx.Type))
+	enc.WriteString(tx.From)
+	enc.WriteString(tx.To)
+	enc.WriteUint64(tx.Amount)
+	enc.WriteUint64(tx.Fee)
+	enc.WriteUint64(tx.Nonce)
+	enc.WriteInt64(tx.Timestamp)
+	enc.WriteString(tx.Asset)
+	enc.WriteUint8(tx.Decimals)
+	enc.WriteUint64(tx.MaxSupply)
+	enc.WriteString(tx.HashLock)
+	enc.WriteUint64(tx.Expiry)
+	enc.WriteString(tx.Preimage)
+	enc.WriteString(tx.ContractID)
+	return enc.Bytes()
+}
+
+// Size returns the number of bytes the transaction counts for against the
+// block size limit: its canonical body followed by its signature and public
+// key, each length-prefixed
+func (tx *Transaction) Size() int {
+	enc := codec.NewEncoder()
+	enc.WriteBytes(tx.EncodeBody())
+	enc.WriteString(tx.Signature)
+	enc.WriteString(tx.PublicKey)
+	return enc.Len()
+}
+
+// Size returns the number of bytes the block counts for against the block
+// size limit: its encoded header plus the size of every transaction and
+// encoded evidence. The block signature is a fixed overhead and not counted.
+func (b *Block) Size() int {
+	size := len(b.EncodeHeader())
+	for _, tx := range b.Transactions {
+		size += tx.Size()
+	}
+	for _, ev := range b.Evidence {
+		size += len(ev.Encode())
+	}
+	return size
+}
+
+// EncodeHeader returns the canonical encoding of the block header. The
+// block hash is its SHA-256 hash and the validator signature covers it.
+func (b *Block) EncodeHeader() []byte {
+	return b.Header().Encode()
+}
+
+// Encode returns the canonical encoding of the header's hashed fields
+func (h *BlockHeader) Encode() []byte {
+	enc := codec.NewEncoder()
+	enc.WriteUint8(EncodingVersion)
+	enc.WriteUint8(kindBlockHeader)
+	enc.WriteString(h.ChainID)
+	enc.WriteUint64(h.Index)
+	enc.WriteInt64(h.Timestamp)
+	enc.WriteString(h.PrevHash)
+	enc.WriteString(h.Validator)
+	enc.WriteString(h.TxRoot)
+	enc.WriteString(h.StateRoot)
+	enc.WriteString(h.EvidenceRoot)
+	enc.WriteString(h.ReceiptsRoot)
+	enc.WriteString(h.ValidatorSetHash)
+	enc.WriteString(h.RandaoReveal)
+	enc.WriteString(h.RandaoCommit)
+	return enc.Bytes()
+}
+
+// Encode returns the canonical encoding of a receipt, hashed into the
+// block's receipts root. The error message is informational and not encoded.
+func (r *Receipt) Encode() []byte {
+	enc := codec.NewEncoder()
+	enc.WriteUint8(EncodingVersion)
+	enc.WriteUint8(kindReceipt)
+	enc.WriteString(r.TxID)
+	enc.WriteUint8(uint8(r.Status))
+	enc.WriteUint64(r.FeePaid)
+	enc.WriteUint64(r.BlockHeight)
+	enc.WriteUint32(uint32(r.Position))
+	enc.WriteUint32(uint32(len(r.Events)))
+	for _, ev := range r.Events {
+		enc.WriteUint8(uint8(ev.Type))
+		enc.WriteString(ev.From)
+		enc.WriteString(ev.To)
+		enc.WriteString(ev.Asset)
+		enc.WriteUint64(ev.Amount)
+	}
+	return enc.Bytes()
+}
+
+// Encode returns the canonical encoding of double-sign evidence. The two
+// headers are ordered by hash so both orderings encode identically; the
+// evidence ID is the SHA-256 hash of the encoding.
+func (ev *Evidence) Encode() []byte {
+	first, second := ev.HeaderA, ev.HeaderB
+	if first == nil {
+		first = &BlockHeader{}
+	}
+	if second == nil {
+		second = &BlockHeader{}
+	}
+	if second.Hash < first.Hash {
+		first, second = second, first
+	}
+
+	enc := codec.NewEncoder()
+	enc.WriteUint8(EncodingVersion)
+	enc.WriteUint8(kindEvidence)
+	for _, header := range []*BlockHeader{first, second} {
+		enc.WriteBytes(header.Encode())
+		enc.WriteString(header.Signature)
+	}
+	return enc.Bytes()
+}
+
+// Encode returns the canonical encoding of a vote's signed fields
+func (v *Vote) Encode() []byte {
+	enc := codec.NewEncoder()
+	enc.WriteUint8(EncodingVersion)
+	enc.WriteUint8(kindVote)
+	enc.WriteString(v.ChainID)
+	enc.WriteUint8(uint8(v.Type))
+	enc.WriteUint64(v.Height)
+	enc.WriteUint32(v.Round)
+	enc.WriteString(v.BlockHash)
+	enc.WriteString(v.Validator)
+	return enc.Bytes()
+}
+
+// encodeValidatorSet returns the canonical encoding of a validator set, in
+// set order
+func encodeValidatorSet(validators []ActiveValidator) []byte {
+	enc := codec.NewEncoder()
+	enc.WriteUint8(EncodingVersion)
+	enc.WriteUint8(kindValidatorSet)
+	enc.WriteUint32(uint32(len(validators)))
+	for _, v := range validators {
+		enc.WriteString(v.Address)
+		enc.WriteString(v.PublicKey)
+		enc.WriteUint64(v.Stake)
+		enc.WriteUint64(v.Delegated)
+	}
+	return enc.Bytes()
+}
+
+// Encode returns the canonical encoding of the genesis document. Allocations
+// and validators are ordered by address, so their order in the file does
+// not change the genesis hash.
+func (g *Genesis) Encode() []byte {
+	allocations := append([]GenesisAllocation(nil), g.Allocations...)
+	sort.Slice(allocations, func(i, j int) bool {
+		return allocations[i].Address < allocations[j].Address
+	})
+	validators := append([]GenesisValidator(nil), g.Validators...)
+	sort.Slice(validators, func(i, j int) bool {
+		return validators[i].Address < validators[j].Address
+	})
+
+	enc := codec.NewEncoder()
+	enc.WriteUint8(EncodingVersion)
+	enc.WriteUint8(kindGenesis)
+	enc.WriteString(g.ChainID)
+	enc.WriteInt64(g.GenesisTime)
+	g.Params.encode(enc)
+	enc.WriteUint32(uint32(len(allocations)))
+	for _, alloc := range allocations {
+		enc.WriteString(alloc.Address)
+		enc.WriteUint64(alloc.Balance)
+	}
+	enc.WriteUint32(uint32(len(validators)))
+	for _, v := range validators {
+		enc.WriteString(v.Address)
+		enc.WriteString(v.PublicKey)
+		enc.WriteUint64(v.Stake)
+	}
+	return enc.Bytes()
+}
+
+// encode appends the canonical encoding of the parameters, in field order
+func (p Params) encode(enc *codec.Encoder) {
+	enc.WriteUint64(p.UnbondingPeriod)
+	enc.WriteUint64(p.SlashFraction)
+	enc.WriteUint64(p.SlashRewardShare)
+	enc.WriteUint64(p.MaxBlockBytes)
+	enc.WriteUint64(p.MaxBlockTxs)
+	enc.WriteUint64(p.EpochLength)
+	enc.WriteUint64(p.MaxValidators)
+	enc.WriteUint64(p.MinValidatorStake)
+	enc.WriteUint64(p.SlotDuration)
+	encodePolicy(enc, p.Monetary)
+}
+
+// encodePolicy writes a monetary policy in field order
+func encodePolicy(enc *codec.Encoder, p monetary.Policy) {
+	enc.WriteString(string(p.Schedule))
+	enc.WriteUint64(p.BlockReward)
+	enc.WriteUint64(p.HalvingInterval)
+	enc.WriteUint64(p.InflationMin)
+	enc.WriteUint64(p.InflationMax)
+	enc.WriteUint64(p.TargetStakingRatio)
+	enc.WriteUint64(p.BlocksPerYear)
+	enc.WriteUint64(p.FeeBurnShare)
+}
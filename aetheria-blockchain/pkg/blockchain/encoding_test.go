@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// The golden vectors of docs/ENCODING.md. A change to any of them is a
+// change to the canonical encoding and must bump EncodingVersion.
+
+const (
+	vectorTxBody      = "02010000000d61657468657269612d74657374000000002836356236303637336436656438383462663031633263323232643832616461303734306632396163000000283661316635633065306232643365346635613662376338643965306631613262336334643565366600000000000005dc000000000000000a0000000000000007000000006553f100000000000000000000000000000000000000000000000000000000000000000000"
+	vectorTxID        = "9cc6a7cca8694de93c2d546f0b486ddd269bfa0e256d055e92521a53abf6bff0"
+	vectorTxSignature = "e898bae2db879bc1f764646b4afcf9cbcba03c1f5a5a7c77d11909072e6c63491227a8dc75b8429e8100a9d78c3be7ca3042b76e4b923336ff8ed74951d4cf0b"
+
+	vectorTxRoot         = "39e08bcf56b02ffab363fa17ad9fb52485436524e260c47b05cceb3ea17ca04d"
+	vectorHeader         = "02020000000d61657468657269612d746573740000000000000001000000006553f1050000004030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030000000283635623630363733643665643838346266303163326332323264383261646130373430663239616300000040333965303862636635366230326666616233363366613137616439666235323438353433363532346532363063343762303563636562336561313763613034640000004031313131313131313131313131313131313131313131313131313131313131313131313131313131313131313131313131313131313131313131313131313131000000406533623063343432393866633163313439616662663463383939366662393234323761653431653436343962393334636134393539393162373835326238353500000040323232323232323232323232323232323232323232323232323232323232323232323232323232323232323232323232323232323232323232323232323232320000000000000040333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333333330000004034343434343434343434343434343434343434343434343434343434343434343434343434343434343434343434343434343434343434343434343434343434"
+	vectorBlockHash      = "1e0a4d9dbe8cf649cd1d3fc88236190dfb02d83b6ddd51361b2a91601a95ad36"
+	vectorBlockSignature = "daba8788610e40e5a9ac5a06d21060c355a6c19ab9c313da7245dcf0dee7876f111c30f80baad01cfe349306989dff7bb932edafe9a567041290d0a140174905"
+
+	vectorGenesis      = "02040000000d61657468657269612d74657374000000006553f100000000000000006400000000000001f400000000000003e8000000000010000000000000000013880000000000000064000000000000006400000000000003e8000000000000000500000005666978656400000000000000320000000000200b2000000000000002bc00000000000007d00000000000001a2c0000000000604e60000000000000000000000001000000283635623630363733643665643838346266303163326332323264383261646130373430663239616300000000000f4240000000010000002836356236303637336436656438383462663031633263323232643832616461303734306632396163000000403739623535363265386665363534663934303738623131326538613938626137393031663835336165363935626564376530653339313062616430343936363400000000000003e8"
+	vectorGenesisHash  = "35776b4b27b5bdf5080e15f94d103795d599202fcbf0bd720a1684399d8a07dc"
+	vectorGenesisBlock = "c27e58d16ce04b80d5c0eef4e9856ffdd3ab47a764f140f008e7e5895e6da3ee"
+)
+
+// vectorKey returns the signing key of the vectors, seeded with 0x01..0x20
+func vectorKey() ed25519.PrivateKey {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i + 1)
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// vectorTransactions returns the coinbase and transfer of the vectors
+func vectorTransactions(key ed25519.PrivateKey) (*Transaction, *Transaction) {
+	from := crypto.PublicKeyToAddress(key.Public().(ed25519.PublicKey))
+
+	coinbase := &Transaction{ChainID: "aetheria-test", To: from, Amount: 1000000}
+	coinbase.ID = coinbase.calculateID()
+
+	transfer := &Transaction{
+		ChainID:   "aetheria-test",
+		From:      from,
+		To:        "6a1f5c0e0b2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f",
+		Amount:    1500,
+		Fee:       10,
+		Nonce:     7,
+		Timestamp: 1700000000,
+	}
+	transfer.ID = transfer.calculateID()
+	transfer.Sign(key)
+	return coinbase, transfer
+}
+
+func TestTransactionVector(t *testing.T) {
+	_, tx := vectorTransactions(vectorKey())
+
+	if got := hex.EncodeToString(tx.EncodeBody()); got != vectorTxBody {
+		t.Errorf("body = %s, want %s", got, vectorTxBody)
+	}
+	if tx.ID != vectorTxID {
+		t.Errorf("id = %s, want %s", tx.ID, vectorTxID)
+	}
+	if tx.Signature != vectorTxSignature {
+		t.Errorf("signature = %s, want %s", tx.Signature, vectorTxSignature)
+	}
+	if err := tx.Verify(); err != nil {
+		t.Errorf("vector transaction does not verify: %v", err)
+	}
+}
+
+func TestBlockHeaderVector(t *testing.T) {
+	key := vectorKey()
+	coinbase, transfer := vectorTransactions(key)
+
+	block := &Block{
+		ChainID:      "aetheria-test",
+		Index:        1,
+		Timestamp:    1700000005,
+		Transactions: []*Transaction{coinbase, transfer},
+		PrevHash:     strings.Repeat("0", 64),
+		Validator:    crypto.PublicKeyToAddress(key.Public().(ed25519.PublicKey)),
+		StateRoot:    strings.Repeat("1", 64),
+		ReceiptsRoot: strings.Repeat("2", 64),
+		RandaoReveal: strings.Repeat("3", 64),
+		RandaoCommit: strings.Repeat("4", 64),
+	}
+	block.TxRoot = block.calculateTxRoot()
+	block.EvidenceRoot = block.calculateEvidenceRoot()
+	block.Hash = block.calculateHash()
+	block.Sign(key)
+
+	if block.TxRoot != vectorTxRoot {
+		t.Errorf("tx root = %s, want %s", block.TxRoot, vectorTxRoot)
+	}
+	if got := hex.EncodeToString(block.EncodeHeader()); got != vectorHeader {
+		t.Errorf("header = %s, want %s", got, vectorHeader)
+	}
+	if block.Hash != vectorBlockHash {
+		t.Errorf("hash = %s, want %s", block.Hash, vectorBlockHash)
+	}
+	if block.Signature != vectorBlockSignature {
+		t.Errorf("signature = %s, want %s", block.Signature, vectorBlockSignature)
+	}
+}
+
+func TestGenesisVector(t *testing.T) {
+	key := vectorKey()
+	publicKey := key.Public().(ed25519.PublicKey)
+	address := crypto.PublicKeyToAddress(publicKey)
+
+	genesis := NewGenesis("aetheria-test", 1700000000)
+	genesis.Allocations = append(genesis.Allocations, GenesisAllocation{Address: address, Balance: 1000000})
+	genesis.Validators = append(genesis.Validators, GenesisValidator{
+		Address:   address,
+		PublicKey: crypto.PublicKeyToHex(publicKey),
+		Stake:     1000,
+	})
+	if err := genesis.Validate(); err != nil {
+		t.Fatalf("vector genesis is invalid: %v", err)
+	}
+
+	if got := hex.EncodeToString(genesis.Encode()); got != vectorGenesis {
+		t.Errorf("genesis = %s, want %s", got, vectorGenesis)
+	}
+	if got := genesis.Hash(); got != vectorGenesisHash {
+		t.Errorf("genesis hash = %s, want %s", got, vectorGenesisHash)
+	}
+	if got := genesis.Block(genesis.State()).Hash; got != vectorGenesisBlock {
+		t.Errorf("genesis block = %s, want %s", got, vectorGenesisBlock)
+	}
+}
+
+func TestEncodingDocumentMatchesVectors(t *testing.T) {
+	doc, err := os.ReadFile(filepath.Join("..", "..", "docs", "ENCODING.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(doc)
+
+	version := fmt.Sprintf("(currently `0x%02x`)", EncodingVersion)
+	if !strings.Contains(text, version) {
+		t.Errorf("docs/ENCODING.md does not document version 0x%02x", EncodingVersion)
+	}
+
+	vectors := map[string]string{
+		"transaction body":      vectorTxBody,
+		"transaction id":        vectorTxID,
+		"transaction signature": vectorTxSignature,
+		"transaction root":      vectorTxRoot,
+		"header":                vectorHeader,
+		"block hash":            vectorBlockHash,
+		"block signature":       vectorBlockSignature,
+		"genesis":               vectorGenesis,
+		"genesis hash":          vectorGenesisHash,
+		"genesis block":         vectorGenesisBlock,
+	}
+	for name, vector := range vectors {
+		if !strings.Contains(text, vector) {
+			t.Errorf("docs/ENCODING.md is missing the %s vector %s", name, vector)
+		}
+	}
+}
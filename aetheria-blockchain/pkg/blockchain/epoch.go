@@ -0,0 +1,114 @@
+package blockchain
+
+import (
+	"sort"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// ActiveValidator is a member of an epoch's validator set. Its stake and
+// delegations are frozen at the start of the epoch, so its voting power
+// does not change until the next one.
+type ActiveValidator struct {
+	Address   string `json:"address"`
+	PublicKey string `json:"public_key"` // hex key that signs the validator's blocks and votes
+	Stake     uint64 `json:"stake"`      // own bonded stake at the epoch start
+	Delegated uint64 `json:"delegated"`  // stake delegated to it at the epoch start
+}
+
+// Power returns the validator's voting power for the epoch
+func (v ActiveValidator) Power() uint64 {
+	return v.Stake + v.Delegated
+}
+
+// IsEpochStart reports whether the block at height starts an epoch, and so
+// elects a new validator set
+func (p Params) IsEpochStart(height uint64) bool {
+	return p.EpochLength <= 1 || height%p.EpochLength == 0
+}
+
+// Epoch returns the number of the epoch the block at height belongs to
+func (p Params) Epoch(height uint64) uint64 {
+	if p.EpochLength <= 1 {
+		return height
+	}
+	return height / p.EpochLength
+}
+
+// ActiveValidators returns the validator set of the current epoch, highest
+// voting power first. Validators tombstoned since the epoch started are left
+// out: they lose their place at once rather than at the next election.
+func (s *State) ActiveValidators() []ActiveValidator {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	active := make([]ActiveValidator, 0, len(s.Validators))
+	for _, v := range s.Validators {
+		if !s.Tombstoned[v.Address] {
+			active = append(active, v)
+		}
+	}
+	return active
+}
+
+// ValidatorSetHash returns the hash of the validator set elected at the
+// start of the current epoch
+func (s *State) ValidatorSetHash() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ValidatorSetHash(s.Validators)
+}
+
+// headerValidatorSetHash returns the validator set hash the header of the
+// block at height must carry, the state being the block's post-state: the
+// hash of the newly elected set for the first block of an epoch, and empty
+// for every other block
+func (s *State) headerValidatorSetHash(height uint64) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.params.IsEpochStart(height) {
+		return ""
+	}
+	return ValidatorSetHash(s.Validators)
+}
+
+// electValidators replaces the validator set with the untombstoned
+// validators holding a registered key and at least MinValidatorStake of
+// their own stake, ranked by voting power with ties
+// broken by address and capped at MaxValidators; callers must hold s.mu
+func (s *State) electValidators() {
+	candidates := make([]ActiveValidator, 0, len(s.Stakes))
+	for addr, stake := range s.Stakes {
+		if stake == 0 || stake < s.params.MinValidatorStake || s.Tombstoned[addr] {
+			continue
+		}
+		if _, err := crypto.PublicKeyFromHex(s.ValidatorKeys[addr]); err != nil {
+			continue
+		}
+		candidates = append(candidates, ActiveValidator{
+			Address:   addr,
+			PublicKey: s.ValidatorKeys[addr],
+			Stake:     stake,
+			Delegated: s.delegated(addr),
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		pi, pj := candidates[i].Power(), candidates[j].Power()
+		if pi != pj {
+			return pi > pj
+		}
+		return candidates[i].Address < candidates[j].Address
+	})
+	if max := s.params.MaxValidators; max > 0 && uint64(len(candidates)) > max {
+		candidates = candidates[:max]
+	}
+	s.Validators = candidates
+}
+
+// ValidatorSetHash returns the hash of a validator set's canonical encoding,
+// which commits to its order
+func ValidatorSetHash(validators []ActiveValidator) string {
+	return crypto.HashString(encodeValidatorSet(validators))
+}
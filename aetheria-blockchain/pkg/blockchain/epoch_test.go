@@ -0,0 +1,117 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+// activeAddresses returns the addresses of the state's validator set in order
+func activeAddresses(state *State) []string {
+	active := state.ActiveValidators()
+	addresses := make([]string, len(active))
+	for i, v := range active {
+		addresses[i] = v.Address
+	}
+	return addresses
+}
+
+func TestValidatorSetChangesAtEpochStart(t *testing.T) {
+	keys := newTestKeys(t, 3)
+	genesis := newTestGenesis(keys)
+	genesis.Params.EpochLength = 3
+	genesis.Params.MaxValidators = 2
+	for i := range genesis.Validators {
+		genesis.Validators[i].Stake = uint64(i+1) * MinStakeAmount
+	}
+	bc := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+
+	elected := []string{keys[2].Address(), keys[1].Address()}
+	if got := activeAddresses(bc.HeadState()); len(got) != 2 || got[0] != elected[0] || got[1] != elected[1] {
+		t.Fatal("expected genesis to elect the two largest stakes, largest first")
+	}
+
+	// The smallest validator outbids the others during epoch 0
+	stake := NewStakeTransaction(testChainID, keys[0].Address(), 10*MinStakeAmount, 1, 0)
+	if err := stake.Sign(keys[0].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(stake); err != nil {
+		t.Fatal(err)
+	}
+
+	for height := uint64(1); height < 3; height++ {
+		block := mineBlock(t, bc, keys)
+		if block.ValidatorSetHash != "" {
+			t.Fatalf("block %d inside an epoch carries a validator set hash", height)
+		}
+		if got := activeAddresses(bc.HeadState()); got[0] != elected[0] || got[1] != elected[1] {
+			t.Fatalf("validator set changed at block %d, inside an epoch", height)
+		}
+	}
+
+	block := mineBlock(t, bc, keys)
+	state := bc.HeadState()
+	got := activeAddresses(state)
+	if len(got) != 2 || got[0] != keys[0].Address() || got[1] != keys[2].Address() {
+		t.Fatal("expected block 3 to elect the new largest stake and drop the smallest")
+	}
+	if block.ValidatorSetHash == "" || block.ValidatorSetHash != state.ValidatorSetHash() {
+		t.Fatal("expected the epoch's first block to commit to the elected set")
+	}
+}
+
+func TestEpochStartMustCommitToElectedSet(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	genesis := newTestGenesis(keys)
+	genesis.Params.EpochLength = 2
+	bc := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+	mineBlock(t, bc, keys)
+
+	for _, hash := range []string{"", ValidatorSetHash(nil)} {
+		block := nextBlock(t, bc, keys, 0)
+		block.ValidatorSetHash = hash
+		block.Hash = block.calculateHash()
+		if err := block.Sign(keys[0].PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.AddBlock(block); err == nil {
+			t.Fatalf("expected an epoch start with validator set hash %q to be refused", hash)
+		}
+	}
+	mineBlock(t, bc, keys)
+}
+
+func TestMinValidatorStake(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	genesis := newTestGenesis(keys[:1])
+	genesis.Allocations = append(genesis.Allocations, GenesisAllocation{Address: keys[1].Address(), Balance: 1000000})
+
+	low := newTestGenesis(keys[:1])
+	low.Validators[0].Stake = genesis.Params.MinValidatorStake - 1
+	if err := low.Validate(); err == nil {
+		t.Fatal("expected a genesis validator below the minimum stake to be refused")
+	}
+
+	// A stake that leaves the sender below the minimum fails
+	state := genesis.State()
+	stake := NewStakeTransaction(testChainID, keys[1].Address(), MinStakeAmount-1, 1, 0)
+	if err := stake.Sign(keys[1].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := state.ApplyTransaction(stake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status == StatusSuccess || state.GetStake(keys[1].Address()) != 0 {
+		t.Fatal("expected a stake below the minimum to fail")
+	}
+
+	// Stake that drops below the minimum, as by slashing, is not elected
+	state.mu.Lock()
+	state.Stakes[keys[1].Address()] = MinStakeAmount - 1
+	state.ValidatorKeys[keys[1].Address()] = stake.PublicKey
+	state.electValidators()
+	state.mu.Unlock()
+	if got := activeAddresses(state); len(got) != 1 || got[0] != keys[0].Address() {
+		t.Fatalf("expected only the validator at the minimum stake elected, got %d", len(got))
+	}
+}
@@ -0,0 +1,65 @@
+package blockchain
+
+import "github.com/aetheria/blockchain/pkg/events"
+
+// NewBlockEvent is published for every block joining the canonical chain,
+// oldest first, including the blocks a reorganization adopts
+type NewBlockEvent struct {
+	Block *Block `json:"block"`
+}
+
+// Topic returns events.TopicNewBlock
+func (NewBlockEvent) Topic() events.Topic { return events.TopicNewBlock }
+
+// ReorgEvent is published when the canonical chain switches to another
+// branch, before the NewBlockEvents for the adopted blocks
+type ReorgEvent struct {
+	Ancestor uint64   `json:"ancestor"` // height of the common ancestor
+	Orphaned []*Block `json:"orphaned"` // blocks leaving the chain, tip first
+	Adopted  []*Block `json:"adopted"`  // blocks joining the chain, oldest first
+}
+
+// Topic returns events.TopicReorg
+func (ReorgEvent) Topic() events.Topic { return events.TopicReorg }
+
+// FinalizedEvent is published when a commit makes a block final, and with
+// it every block below it on its branch
+type FinalizedEvent struct {
+	Block *Block `json:"block"`
+}
+
+// Topic returns events.TopicFinalized
+func (FinalizedEvent) Topic() events.Topic { return events.TopicFinalized }
+
+// TxAddedEvent is published when a transaction enters the mempool
+type TxAddedEvent struct {
+	Tx *Transaction `json:"tx"`
+}
+
+// Topic returns events.TopicTxAdded
+func (TxAddedEvent) Topic() events.Topic { return events.TopicTxAdded }
+
+// EvictReason says why a transaction left the mempool unmined
+type EvictReason string
+
+const (
+	// EvictReplaced means a transaction with the same sender and nonce
+	// paying a higher fee took its place
+	EvictReplaced EvictReason = "replaced"
+	// EvictPoolFull means it paid too little to keep its place in a full pool
+	EvictPoolFull EvictReason = "pool_full"
+	// EvictExpired means it waited longer than the mempool expiry
+	EvictExpired EvictReason = "expired"
+	// EvictStale means the chain mined another transaction with its nonce
+	EvictStale EvictReason = "stale"
+)
+
+// TxEvictedEvent is published when a transaction leaves the mempool without
+// being mined
+type TxEvictedEvent struct {
+	Tx     *Transaction `json:"tx"`
+	Reason EvictReason  `json:"reason"`
+}
+
+// Topic returns events.TopicTxEvicted
+func (TxEvictedEvent) Topic() events.Topic { return events.TopicTxEvicted }
@@ -0,0 +1,153 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// Evidence proves that a validator signed two different blocks at the same
+// height in the same slot. A validator leads a slot at most once, so an
+// honest one never does; blocks it signs at one height in different slots,
+// on branches a reorganization switches between, are not evidence.
+// Including it in a block slashes and tombstones the validator.
+type Evidence struct {
+	HeaderA *BlockHeader `json:"header_a"`
+	HeaderB *BlockHeader `json:"header_b"`
+}
+
+// NewEvidence creates double-sign evidence from two conflicting blocks
+func NewEvidence(a, b *Block) *Evidence {
+	return &Evidence{
+		HeaderA: a.Header(),
+		HeaderB: b.Header(),
+	}
+}
+
+// ID returns the evidence identifier
+func (ev *Evidence) ID() string {
+	return crypto.HashString(ev.Encode())
+}
+
+// Validator returns the address of the offending validator
+func (ev *Evidence) Validator() string {
+	return ev.HeaderA.Validator
+}
+
+// ChainID returns the chain the conflicting headers were signed for
+func (ev *Evidence) ChainID() string {
+	if ev.HeaderA == nil {
+		return ""
+	}
+	return ev.HeaderA.ChainID
+}
+
+// Height returns the height at which the validator double-signed
+func (ev *Evidence) Height() uint64 {
+	return ev.HeaderA.Index
+}
+
+// Verify checks that both headers are correctly hashed, signed by the
+// holder of publicKey, and conflict at the same height and slot
+func (ev *Evidence) Verify(publicKey string) error {
+	if ev.HeaderA == nil || ev.HeaderB == nil {
+		return fmt.Errorf("evidence needs two headers")
+	}
+	if ev.HeaderA.ChainID != ev.HeaderB.ChainID {
+		return fmt.Errorf("headers are from different chains")
+	}
+	if ev.HeaderA.Validator != ev.HeaderB.Validator {
+		return fmt.Errorf("headers are from different validators")
+	}
+	if ev.HeaderA.Index != ev.HeaderB.Index {
+		return fmt.Errorf("headers are at different heights")
+	}
+	// A block's timestamp is the start of its slot
+	if ev.HeaderA.Timestamp != ev.HeaderB.Timestamp {
+		return fmt.Errorf("headers are in different slots")
+	}
+
+	key, err := crypto.PublicKeyFromHex(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid validator key: %w", err)
+	}
+
+	for _, header := range []*BlockHeader{ev.HeaderA, ev.HeaderB} {
+		data := header.Encode()
+		if header.Hash != crypto.HashString(data) {
+			return fmt.Errorf("header hash mismatch at height %d", header.Index)
+		}
+		signature, err := crypto.SignatureFromHex(header.Signature)
+		if err != nil {
+			return fmt.Errorf("invalid header signature: %w", err)
+		}
+		if !crypto.Verify(key, data, signature) {
+			return fmt.Errorf("header %s not signed by %s", header.Hash, header.Validator)
+		}
+	}
+
+	if ev.HeaderA.Hash == ev.HeaderB.Hash {
+		return fmt.Errorf("headers are identical")
+	}
+	return nil
+}
+
+// IsTombstoned reports whether a validator has been slashed for
+// double-signing and permanently removed from the validator set
+func (s *State) IsTombstoned(validator string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Tombstoned[validator]
+}
+
+// CheckEvidence reports whether evidence can still be applied to the state
+func (s *State) CheckEvidence(ev *Evidence) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.checkEvidence(ev)
+}
+
+// checkEvidence validates evidence against the state; callers must hold s.mu
+func (s *State) checkEvidence(ev *Evidence) error {
+	if ev.HeaderA == nil || ev.HeaderB == nil {
+		return fmt.Errorf("evidence needs two headers")
+	}
+	validator := ev.Validator()
+	if s.Tombstoned[validator] {
+		return fmt.Errorf("validator %s is already tombstoned", validator)
+	}
+	if ev.Height() > s.Height {
+		return fmt.Errorf("evidence at height %d is above the current height %d", ev.Height(), s.Height)
+	}
+	if ev.Height()+s.params.UnbondingPeriod < s.Height {
+		return fmt.Errorf("evidence at height %d is older than the unbonding period", ev.Height())
+	}
+
+	publicKey, ok := s.ValidatorKeys[validator]
+	if !ok {
+		return fmt.Errorf("unknown validator %s", validator)
+	}
+	return ev.Verify(publicKey)
+}
+
+// ApplyEvidence slashes the offending validator and tombstones it. A share
+// of the slashed amount rewards proposer, the validator of the block
+// including the evidence; the rest is burned. It returns the amount slashed.
+func (s *State) ApplyEvidence(ev *Evidence, proposer string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkEvidence(ev); err != nil {
+		return 0, err
+	}
+
+	validator := ev.Validator()
+	slashed := s.slash(validator, s.params.SlashFraction)
+	reward := mulDiv(slashed, s.params.SlashRewardShare, BasisPoints)
+	s.Balances[proposer] += reward
+	s.TotalBurned -= reward
+	s.Tombstoned[validator] = true
+	s.touch(proposer)
+	s.touch(validator)
+	return slashed, nil
+}
@@ -0,0 +1,63 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+func TestDoubleSignInSameSlot(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	bc := newTestChain(t, newTestGenesis(keys), NewMemoryBlockStore(), nil)
+	block := mineBlock(t, bc, keys)
+
+	twin := *block
+	twin.StateRoot = strings.Repeat("0", 64)
+	twin.Hash = twin.calculateHash()
+	if err := twin.Sign(keys[0].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := bc.DetectDoubleSign(&twin)
+	if ev == nil {
+		t.Fatal("expected two blocks in one slot to be a double-sign")
+	}
+	if err := ev.Verify(crypto.PublicKeyToHex(keys[0].PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHonestReorgIsNotDoubleSign(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	genesis := newTestGenesis(keys)
+	bc := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+	orphan := mineBlock(t, bc, keys)
+
+	// The validator builds at the same height again on another branch, in a
+	// later slot, and that branch wins
+	other := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+	replacement := nextBlock(t, other, keys, 1)
+	if err := other.AddBlock(replacement); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range []*Block{replacement, mineBlock(t, other, keys)} {
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		if ev := bc.DetectDoubleSign(block); ev != nil {
+			t.Fatalf("block %d in its own slot reported as a double-sign", block.Index)
+		}
+	}
+	if bc.GetBlock(1).Hash != replacement.Hash {
+		t.Fatal("expected the chain to reorganize onto the other branch")
+	}
+
+	ev := NewEvidence(orphan, replacement)
+	if err := ev.Verify(crypto.PublicKeyToHex(keys[0].PublicKey)); err == nil {
+		t.Fatal("expected headers from different slots not to be evidence")
+	}
+	if err := bc.HeadState().CheckEvidence(ev); err == nil {
+		t.Fatal("expected the chain to refuse evidence from different slots")
+	}
+}
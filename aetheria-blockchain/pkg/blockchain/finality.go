@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+)
+
+// FinalizedHeight returns the height of the newest final block. Every
+// canonical block at or below it is final and can never be reverted.
+func (bc *Blockchain) FinalizedHeight() uint64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.finalized.block.Index
+}
+
+// IsFinal reports whether the canonical block at height is final
+func (bc *Blockchain) IsFinal(height uint64) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return height <= bc.finalized.block.Index
+}
+
+// AddCommit makes the block a commit is for final, along with its
+// ancestors, once the commit's precommits are verified. The block must be
+// known and descend from the current final block; if it is not canonical,
+// the chain reorganizes onto it.
+func (bc *Blockchain) AddCommit(commit *Commit) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.addCommit(commit)
+}
+
+// addCommit verifies, stores and applies a commit; callers must hold bc.mu
+func (bc *Blockchain) addCommit(commit *Commit) error {
+	node, ok := bc.tree[commit.BlockHash]
+	if !ok {
+		return fmt.Errorf("unknown block %s", commit.BlockHash)
+	}
+	if node.block.Commit != nil {
+		return nil
+	}
+	if !extends(node, bc.finalized) && !extends(bc.finalized, node) {
+		return fmt.Errorf("block %d conflicts with final block %d", node.block.Index, bc.finalized.block.Index)
+	}
+
+	state, err := bc.stateOf(node)
+	if err != nil {
+		return err
+	}
+	if err := verifyCommit(commit, node.block, state); err != nil {
+		return fmt.Errorf("invalid commit: %w", err)
+	}
+
+	node.block.Commit = commit
+	if err := bc.store.Append(node.block); err != nil {
+		node.block.Commit = nil
+		return fmt.Errorf("failed to store commit: %w", err)
+	}
+
+	if node.block.Index > bc.finalized.block.Index {
+		previous := bc.finalized.block.Index
+		bc.headChanged(bc.finalize(node, state))
+		log.Printf("Block %d is final", node.block.Index)
+		bc.events.Publish(FinalizedEvent{Block: node.block})
+
+		if bc.snapshots != nil && bc.snapshots.ShouldSnapshot(previous, node.block.Index) {
+			if _, err := bc.saveSnapshot(); err != nil {
+				log.Printf("Failed to save snapshot at height %d: %v", node.block.Index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// replayCommit applies a stored commit while the chain is reopened. Commits
+// at or below the tree root are trusted like the blocks there, which are
+// only link-checked. Callers must hold bc.mu.
+func (bc *Blockchain) replayCommit(node *blockNode, commit *Commit) error {
+	var state *State
+	if node.block.Index > bc.root.block.Index {
+		var err error
+		if state, err = bc.stateOf(node); err != nil {
+			return err
+		}
+		if err := verifyCommit(commit, node.block, state); err != nil {
+			return err
+		}
+	}
+
+	node.block.Commit = commit
+	if node.block.Index > bc.finalized.block.Index {
+		bc.finalize(node, state)
+	}
+	return nil
+}
+
+// finalize makes node the newest final block. It becomes the tree root, so
+// no branch forking below it is accepted, and the head moves onto its
+// branch if it was elsewhere. state is node's post-state, or nil for a node
+// at or below the root. It returns the blocks removed from and added to
+// the canonical chain; callers must hold bc.mu.
+func (bc *Blockchain) finalize(node *blockNode, state *State) (orphaned, adopted []*Block) {
+	bc.finalized = node
+	if node.block.Index > bc.root.block.Index {
+		if node.state == nil {
+			node.state = state
+			bc.cached = append(bc.cached, node)
+		}
+		bc.root = node
+	}
+
+	if extends(bc.head, node) {
+		return nil, nil
+	}
+	best := node
+	for _, candidate := range bc.tree {
+		if candidate.weight > best.weight && extends(candidate, node) {
+			best = candidate
+		}
+	}
+	return bc.setHead(best)
+}
@@ -0,0 +1,200 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+)
+
+// stateCacheDepth is how many blocks below the head keep their post-state
+// cached; states further back are recomputed from the nearest cached
+// ancestor when a fork needs them
+const stateCacheDepth = 64
+
+// ForkChoice decides which branch of the block tree is canonical. The
+// branch with the highest cumulative weight wins; ties keep the current head.
+type ForkChoice interface {
+	// Weight returns the weight block adds to its branch, given the state
+	// the block builds on
+	Weight(block *Block, parentState *State) uint64
+}
+
+// LongestChain prefers the branch with the most blocks
+type LongestChain struct{}
+
+// Weight counts every block equally
+func (LongestChain) Weight(block *Block, parentState *State) uint64 {
+	return 1
+}
+
+// HeaviestChain prefers the branch backed by the most validator stake
+type HeaviestChain struct{}
+
+// Weight weighs a block by its validator's voting power
+func (HeaviestChain) Weight(block *Block, parentState *State) uint64 {
+	return parentState.GetPower(block.Validator)
+}
+
+// blockNode is a block in the block tree
+type blockNode struct {
+	block    *Block
+	parent   *blockNode
+	weight   uint64     // cumulative fork-choice weight above the tree root
+	state    *State     // post-state; nil once pruned from the cache
+	receipts []*Receipt // nil for blocks up to the root the chain opened at
+}
+
+// insertBlock validates a block against its parent's state and adds it to
+// the block tree without changing the head; callers must hold bc.mu
+func (bc *Blockchain) insertBlock(block *Block) (*blockNode, error) {
+	if _, exists := bc.tree[block.Hash]; exists {
+		return nil, fmt.Errorf("block %s already known", block.Hash)
+	}
+
+	parent, ok := bc.tree[block.PrevHash]
+	if !ok {
+		return nil, fmt.Errorf("unknown parent block %s", block.PrevHash)
+	}
+	if parent != bc.root && parent.block.Index <= bc.root.block.Index {
+		return nil, fmt.Errorf("block %d forks below the chain root at height %d", block.Index, bc.root.block.Index)
+	}
+
+	parentState, err := bc.stateOf(parent)
+	if err != nil {
+		return nil, err
+	}
+	state, receipts, err := bc.validateBlock(block, parent.block, parentState)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &blockNode{
+		block:    block,
+		parent:   parent,
+		weight:   parent.weight + bc.forkChoice.Weight(block, parentState),
+		state:    state,
+		receipts: receipts,
+	}
+	bc.tree[block.Hash] = node
+	bc.heights[block.Index] = append(bc.heights[block.Index], node)
+	bc.cached = append(bc.cached, node)
+	return node, nil
+}
+
+// removeNode undoes insertBlock for the most recently inserted node;
+// callers must hold bc.mu
+func (bc *Blockchain) removeNode(node *blockNode) {
+	delete(bc.tree, node.block.Hash)
+	siblings := bc.heights[node.block.Index]
+	bc.heights[node.block.Index] = siblings[:len(siblings)-1]
+	if len(siblings) == 1 {
+		delete(bc.heights, node.block.Index)
+	}
+	bc.cached = bc.cached[:len(bc.cached)-1]
+}
+
+// stateOf returns the post-state of node, replaying blocks from the nearest
+// ancestor with a cached state if needed; callers must hold bc.mu
+func (bc *Blockchain) stateOf(node *blockNode) (*State, error) {
+	if node.state != nil {
+		return node.state, nil
+	}
+
+	path := make([]*Block, 0)
+	ancestor := node
+	for ancestor.state == nil {
+		if ancestor.parent == nil {
+			return nil, fmt.Errorf("no cached state below block %d", node.block.Index)
+		}
+		path = append(path, ancestor.block)
+		ancestor = ancestor.parent
+	}
+
+	state := ancestor.state.Clone()
+	for i := len(path) - 1; i >= 0; i-- {
+		if _, err := state.ApplyBlock(path[i]); err != nil {
+			return nil, fmt.Errorf("failed to replay block %d: %w", path[i].Index, err)
+		}
+	}
+	return state, nil
+}
+
+// updateHead makes node the head if it outweighs the current head and
+// descends from the newest final block, reorganizing the canonical chain
+// when node is on another branch. It returns the blocks removed from and
+// added to the canonical chain. Callers must hold bc.mu.
+func (bc *Blockchain) updateHead(node *blockNode) (orphaned, adopted []*Block) {
+	if node.weight <= bc.head.weight || !extends(node, bc.finalized) {
+		return nil, nil
+	}
+	return bc.setHead(node)
+}
+
+// setHead makes node the head regardless of weight, returning the blocks
+// removed from and added to the canonical chain; callers must hold bc.mu
+func (bc *Blockchain) setHead(node *blockNode) (orphaned, adopted []*Block) {
+	// Find the common ancestor of the old and new heads
+	oldNode, newNode := bc.head, node
+	for oldNode.block.Index > newNode.block.Index {
+		orphaned = append(orphaned, oldNode.block)
+		oldNode = oldNode.parent
+	}
+	for newNode.block.Index > oldNode.block.Index {
+		adopted = append(adopted, newNode.block)
+		newNode = newNode.parent
+	}
+	for oldNode != newNode {
+		orphaned = append(orphaned, oldNode.block)
+		adopted = append(adopted, newNode.block)
+		oldNode = oldNode.parent
+		newNode = newNode.parent
+	}
+	ancestor := oldNode
+
+	// orphaned is already tip-first, which is the order to unindex in;
+	// adopted must be applied oldest first
+	for i, j := 0, len(adopted)-1; i < j; i, j = i+1, j-1 {
+		adopted[i], adopted[j] = adopted[j], adopted[i]
+	}
+
+	for _, block := range orphaned {
+		bc.index.removeBlock(block)
+	}
+	bc.blocks = bc.blocks[:ancestor.block.Index+1]
+	for _, block := range adopted {
+		bc.blocks = append(bc.blocks, block)
+		bc.index.addBlock(block)
+	}
+
+	if len(orphaned) > 0 {
+		log.Printf("Chain reorganization: %d blocks reverted to common ancestor %d, %d blocks applied",
+			len(orphaned), ancestor.block.Index, len(adopted))
+	}
+
+	bc.head = node
+	bc.state = node.state
+	bc.pruneStates()
+	return orphaned, adopted
+}
+
+// pruneStates drops cached states that are too far below the head, always
+// keeping the root's state; callers must hold bc.mu
+func (bc *Blockchain) pruneStates() {
+	kept := bc.cached[:0]
+	for _, node := range bc.cached {
+		if node != bc.root && node.block.Index+stateCacheDepth < bc.head.block.Index {
+			node.state = nil
+			continue
+		}
+		kept = append(kept, node)
+	}
+	bc.cached = kept
+}
+
+// extends reports whether node is ancestor or descends from it; both must
+// be in the block tree
+func extends(node, ancestor *blockNode) bool {
+	for node != nil && node.block.Index > ancestor.block.Index {
+		node = node.parent
+	}
+	return node == ancestor
+}
@@ -0,0 +1,174 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// buildBranch produces n blocks by keys on a chain of its own holding
+// shared, starting a slot later than the chain the blocks are fed to would
+func buildBranch(t *testing.T, genesis *Genesis, shared []*Block, keys []*crypto.KeyPair, n int) []*Block {
+	t.Helper()
+	other := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+	for _, block := range shared {
+		if err := other.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	branch := make([]*Block, 0, n)
+	for i := 0; i < n; i++ {
+		skip := 0
+		if i == 0 {
+			skip = 1
+		}
+		block := nextBlock(t, other, keys, skip)
+		if err := other.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		branch = append(branch, block)
+	}
+	return branch
+}
+
+// addBlocks adds blocks that must be valid to bc
+func addBlocks(t *testing.T, bc *Blockchain, blocks []*Block) {
+	t.Helper()
+	for _, block := range blocks {
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReorgReturnsOrphanedTransactions(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	genesis := newTestGenesis(keys[:1])
+	bc := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+
+	tx := NewTransaction(testChainID, keys[0].Address(), keys[1].Address(), 100, 10, 0)
+	if err := tx.Sign(keys[0].PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	orphan := mineBlock(t, bc, keys[:1])
+	if _, mined := bc.GetTransactionLocation(tx.ID); !mined {
+		t.Fatal("expected the transaction to be mined")
+	}
+
+	branch := buildBranch(t, genesis, nil, keys[:1], 2)
+	addBlocks(t, bc, branch)
+
+	if bc.GetLatestBlock().Hash != branch[1].Hash {
+		t.Fatal("expected the longer branch to become canonical")
+	}
+	if bc.GetBlockByHash(orphan.Hash) != nil {
+		t.Fatal("orphaned block is still canonical")
+	}
+	if bc.GetKnownBlock(orphan.Hash) == nil {
+		t.Fatal("orphaned block left the block tree")
+	}
+	if _, mined := bc.GetTransactionLocation(tx.ID); mined {
+		t.Fatal("transaction of the orphaned block is still indexed")
+	}
+	pending := bc.PendingTransactions()
+	if len(pending) != 1 || pending[0].ID != tx.ID {
+		t.Fatalf("expected the orphaned transaction back in the pool, got %d pending", len(pending))
+	}
+	if got := bc.HeadState().GetBalance(keys[1].Address()); got != 0 {
+		t.Fatalf("recipient balance %d after the reorg, want 0", got)
+	}
+}
+
+func TestEqualBranchKeepsHead(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	genesis := newTestGenesis(keys)
+	bc := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+	mineBlock(t, bc, keys)
+	head := mineBlock(t, bc, keys)
+
+	addBlocks(t, bc, buildBranch(t, genesis, nil, keys, 2))
+	if bc.GetLatestBlock().Hash != head.Hash {
+		t.Fatal("expected a branch of equal weight not to replace the head")
+	}
+}
+
+func TestReorgFromPrunedState(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	genesis := newTestGenesis(keys)
+	bc := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+
+	shared := []*Block{mineBlock(t, bc, keys), mineBlock(t, bc, keys)}
+	for i := 0; i < stateCacheDepth+4; i++ {
+		mineBlock(t, bc, keys)
+	}
+
+	// The fork point's state has left the cache and must be replayed
+	branch := buildBranch(t, genesis, shared, keys, stateCacheDepth+6)
+	addBlocks(t, bc, branch)
+
+	head := branch[len(branch)-1]
+	if bc.GetLatestBlock().Hash != head.Hash {
+		t.Fatal("expected the longer branch to become canonical")
+	}
+	if bc.GetBlock(2).Hash != shared[1].Hash {
+		t.Fatal("expected the shared blocks to stay canonical")
+	}
+	if root := bc.HeadState().Root(); root != head.StateRoot {
+		t.Fatalf("head state root %s, want %s", root, head.StateRoot)
+	}
+}
+
+func TestReorgStopsAtFinalBlock(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	genesis := newTestGenesis(keys)
+	bc := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+	final := mineBlock(t, bc, keys)
+	commitBlock(t, bc, final, keys)
+
+	// A longer branch conflicting with the final block never wins
+	branch := buildBranch(t, genesis, nil, keys, 3)
+	if err := bc.AddBlock(branch[0]); err == nil {
+		t.Fatal("expected a block conflicting with the final block to be refused")
+	}
+	for _, block := range branch[1:] {
+		if err := bc.AddBlock(block); err == nil {
+			t.Fatalf("expected block %d above a refused block to be refused", block.Index)
+		}
+	}
+	if bc.GetLatestBlock().Hash != final.Hash {
+		t.Fatal("expected the head to stay on the final block")
+	}
+}
+
+func TestHeaviestChainWeighsStake(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	genesis := newTestGenesis(keys)
+	genesis.Validators[0].Stake = 10 * MinStakeAmount
+	heavy, light := keys[:1], keys[1:]
+
+	heavyBranch := buildBranch(t, genesis, nil, heavy, 1)
+	lightBranch := buildBranch(t, genesis, nil, light, 2)
+
+	for _, c := range []struct {
+		forkChoice ForkChoice
+		want       *Block
+	}{
+		{HeaviestChain{}, heavyBranch[0]},
+		{LongestChain{}, lightBranch[1]},
+	} {
+		bc, err := NewBlockchain(NewMemoryBlockStore(), nil, c.forkChoice, genesis, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addBlocks(t, bc, heavyBranch)
+		addBlocks(t, bc, lightBranch)
+		if bc.GetLatestBlock().Hash != c.want.Hash {
+			t.Errorf("%T chose block %d by %s, want block %d by %s", c.forkChoice,
+				bc.GetLatestBlock().Index, bc.GetLatestBlock().Validator, c.want.Index, c.want.Validator)
+		}
+	}
+}
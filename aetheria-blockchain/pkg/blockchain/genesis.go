@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// Genesis is the document a network starts from. Every node of a network
+// must use the same document: the genesis block commits to its hash.
+type Genesis struct {
+	ChainID     string              `json:"chain_id"`
+	GenesisTime int64               `json:"genesis_time"` // unix seconds, the genesis block timestamp
+	Params      Params              `json:"params"`
+	Allocations []GenesisAllocation `json:"allocations"`
+	Validators  []GenesisValidator  `json:"validators"`
+}
+
+// GenesisAllocation is a balance funded at genesis
+type GenesisAllocation struct {
+	Address string `json:"address"`
+	Balance uint64 `json:"balance"`
+}
+
+// GenesisValidator is a validator bonded at genesis
+type GenesisValidator struct {
+	Address   string `json:"address"`
+	PublicKey string `json:"public_key"` // hex key that signs the validator's blocks
+	Stake     uint64 `json:"stake"`
+}
+
+// NewGenesis creates a genesis document with the default parameters and no
+// allocations or validators
+func NewGenesis(chainID string, genesisTime int64) *Genesis {
+	return &Genesis{
+		ChainID:     chainID,
+		GenesisTime: genesisTime,
+		Params:      DefaultParams(),
+		Allocations: make([]GenesisAllocation, 0),
+		Validators:  make([]GenesisValidator, 0),
+	}
+}
+
+// LoadGenesis reads and validates a genesis document from a JSON file
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read genesis file: %w", err)
+	}
+
+	var g Genesis
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("failed to decode genesis file: %w", err)
+	}
+	if err := g.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid genesis file: %w", err)
+	}
+	return &g, nil
+}
+
+// Save writes the genesis document to a JSON file
+func (g *Genesis) Save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode genesis: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write genesis file: %w", err)
+	}
+	return nil
+}
+
+// Hash returns the hash of the document's canonical encoding
+func (g *Genesis) Hash() string {
+	return crypto.HashString(g.Encode())
+}
+
+// Validate checks that the document describes a usable initial state
+func (g *Genesis) Validate() error {
+	if g.ChainID == "" {
+		return fmt.Errorf("chain ID is empty")
+	}
+	if g.Params.SlotDuration == 0 {
+		return fmt.Errorf("slot duration must be positive")
+	}
+	if err := g.Params.Monetary.Validate(); err != nil {
+		return fmt.Errorf("invalid monetary policy: %w", err)
+	}
+
+	funded := make(map[string]bool, len(g.Allocations))
+	for _, alloc := range g.Allocations {
+		if alloc.Address == "" {
+			return fmt.Errorf("allocation has no address")
+		}
+		if funded[alloc.Address] {
+			return fmt.Errorf("duplicate allocation for %s", alloc.Address)
+		}
+		funded[alloc.Address] = true
+	}
+
+	bonded := make(map[string]bool, len(g.Validators))
+	for _, v := range g.Validators {
+		key, err := crypto.PublicKeyFromHex(v.PublicKey)
+		if err != nil {
+			return fmt.Errorf("validator %s has an invalid public key: %w", v.Address, err)
+		}
+		if address := crypto.PublicKeyToAddress(key); v.Address != address {
+			return fmt.Errorf("validator %s does not match its public key (address %s)", v.Address, address)
+		}
+		if v.Stake == 0 {
+			return fmt.Errorf("validator %s has no stake", v.Address)
+		}
+		if v.Stake < g.Params.MinValidatorStake {
+			return fmt.Errorf("validator %s stakes %d, below the minimum validator stake of %d", v.Address, v.Stake, g.Params.MinValidatorStake)
+		}
+		if bonded[v.Address] {
+			return fmt.Errorf("duplicate validator %s", v.Address)
+		}
+		bonded[v.Address] = true
+	}
+	if len(bonded) == 0 {
+		return fmt.Errorf("no validators; the first slot would have no leader")
+	}
+	return nil
+}
+
+// State returns the state the document describes, before any block
+func (g *Genesis) State() *State {
+	state := NewState()
+	state.SetParams(g.Params)
+	for _, alloc := range g.Allocations {
+		state.Balances[alloc.Address] = alloc.Balance
+		state.TotalMinted += alloc.Balance
+	}
+	for _, v := range g.Validators {
+		state.Stakes[v.Address] = v.Stake
+		state.ValidatorKeys[v.Address] = v.PublicKey
+		state.TotalMinted += v.Stake
+	}
+	state.electValidators()
+	state.RandaoMix = g.Hash()
+	return state
+}
+
+// Block returns the genesis block for state, which must be the document's
+// State. Its previous hash is the document hash, so documents that differ
+// in any field produce different genesis blocks. The genesis block starts
+// the first epoch and commits to the genesis validator set.
+func (g *Genesis) Block(state *State) *Block {
+	block := &Block{
+		ChainID:      g.ChainID,
+		Index:        0,
+		Timestamp:    g.GenesisTime,
+		Transactions: make([]*Transaction, 0),
+		PrevHash:     g.Hash(),
+		StateRoot:    state.Root(),
+		Validator:    "genesis",
+	}
+	block.TxRoot = block.calculateTxRoot()
+	block.EvidenceRoot = block.calculateEvidenceRoot()
+	block.ReceiptsRoot = ReceiptsRoot(nil)
+	block.ValidatorSetHash = state.ValidatorSetHash()
+	block.Hash = block.calculateHash()
+	block.Signature = "genesis"
+	return block
+}
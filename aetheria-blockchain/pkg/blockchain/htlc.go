@@ -0,0 +1,204 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/aetheria/blockchain/pkg/codec"
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// htlcKeyPrefix keys open HTLCs in the state tree
+const htlcKeyPrefix = "htlc:"
+
+// HTLC is a hash-time-locked contract: funds locked by Sender that
+// Recipient can claim by revealing the preimage of HashLock before height
+// Expiry, and that Sender can take back from then on. A contract is
+// identified by the ID of the transaction that locked it, so any number of
+// contracts, in any assets, can share a hash lock.
+type HTLC struct {
+	ID        string `json:"id"`        // ID of the lock transaction
+	HashLock  string `json:"hash_lock"` // hex SHA-256 of the preimage
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient"`
+	Asset     string `json:"asset,omitempty"` // issued asset symbol, empty for the native token
+	Amount    uint64 `json:"amount"`
+	Expiry    uint64 `json:"expiry"` // first height at which the lock can be refunded and no longer claimed
+}
+
+// Encode returns the contract's canonical leaf value in the state tree
+func (h *HTLC) Encode() []byte {
+	enc := codec.NewEncoder()
+	enc.WriteString(h.ID)
+	enc.WriteString(h.HashLock)
+	enc.WriteString(h.Sender)
+	enc.WriteString(h.Recipient)
+	enc.WriteString(h.Asset)
+	enc.WriteUint64(h.Amount)
+	enc.WriteUint64(h.Expiry)
+	return enc.Bytes()
+}
+
+// HashLockOf returns the hash lock that preimage opens
+func HashLockOf(preimage []byte) string {
+	return crypto.HashString(preimage)
+}
+
+// validateHashLock checks that a hash lock is a hex SHA-256 digest
+func validateHashLock(hashLock string) error {
+	digest, err := hex.DecodeString(hashLock)
+	if err != nil || len(digest) != 32 || hex.EncodeToString(digest) != hashLock {
+		return fmt.Errorf("hash lock must be 64 lower-case hex characters")
+	}
+	return nil
+}
+
+// GetHTLC returns an open contract by ID
+func (s *State) GetHTLC(id string) (HTLC, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	htlc, ok := s.HTLCs[id]
+	return htlc, ok
+}
+
+// GetHTLCsByHashLock returns the open contracts locked to a hash, sorted by
+// ID
+func (s *State) GetHTLCsByHashLock(hashLock string) []HTLC {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	htlcs := make([]HTLC, 0, len(s.HashLocks[hashLock]))
+	for _, id := range s.HashLocks[hashLock] {
+		htlcs = append(htlcs, s.HTLCs[id])
+	}
+	return htlcs
+}
+
+// GetHTLCs returns every open contract, sorted by ID
+func (s *State) GetHTLCs() []HTLC {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	htlcs := make([]HTLC, 0, len(s.HTLCs))
+	for _, htlc := range s.HTLCs {
+		htlcs = append(htlcs, htlc)
+	}
+	sort.Slice(htlcs, func(i, j int) bool {
+		return htlcs[i].ID < htlcs[j].ID
+	})
+	return htlcs
+}
+
+// applyLockHTLC moves Amount of the sender's native or issued asset balance
+// into a new contract; callers must hold s.mu
+func (s *State) applyLockHTLC(tx *Transaction) error {
+	if err := validateHashLock(tx.HashLock); err != nil {
+		return err
+	}
+	if tx.Amount == 0 {
+		return fmt.Errorf("locked amount must be positive")
+	}
+	if tx.To == "" {
+		return fmt.Errorf("HTLC has no recipient")
+	}
+	if tx.Expiry <= s.Height {
+		return fmt.Errorf("expiry height %d has already passed (height %d)", tx.Expiry, s.Height)
+	}
+
+	if tx.Asset == "" {
+		s.Balances[tx.From] -= tx.Cost()
+	} else {
+		if _, ok := s.Assets[tx.Asset]; !ok {
+			return fmt.Errorf("unknown asset %s", tx.Asset)
+		}
+		if err := s.subAssetBalance(tx.From, tx.Asset, tx.Amount); err != nil {
+			return err
+		}
+		s.Balances[tx.From] -= tx.Fee
+	}
+
+	s.HTLCs[tx.ID] = HTLC{
+		ID:        tx.ID,
+		HashLock:  tx.HashLock,
+		Sender:    tx.From,
+		Recipient: tx.To,
+		Asset:     tx.Asset,
+		Amount:    tx.Amount,
+		Expiry:    tx.Expiry,
+	}
+	s.HashLocks[tx.HashLock] = append(s.HashLocks[tx.HashLock], tx.ID)
+	sort.Strings(s.HashLocks[tx.HashLock])
+	s.touch(htlcKeyPrefix + tx.ID)
+	return nil
+}
+
+// applyClaimHTLC pays a contract to its recipient, the sender, who reveals
+// the preimage of its hash lock before expiry; callers must hold s.mu
+func (s *State) applyClaimHTLC(tx *Transaction) error {
+	htlc, ok := s.HTLCs[tx.ContractID]
+	if !ok {
+		return fmt.Errorf("no open HTLC %s", tx.ContractID)
+	}
+	preimage, err := hex.DecodeString(tx.Preimage)
+	if err != nil {
+		return fmt.Errorf("invalid preimage: %w", err)
+	}
+	if HashLockOf(preimage) != htlc.HashLock {
+		return fmt.Errorf("preimage does not open HTLC %s", htlc.ID)
+	}
+	if tx.From != htlc.Recipient {
+		return fmt.Errorf("only recipient %s may claim HTLC %s", htlc.Recipient, htlc.ID)
+	}
+	if s.Height >= htlc.Expiry {
+		return fmt.Errorf("HTLC %s expired at height %d", htlc.ID, htlc.Expiry)
+	}
+
+	s.Balances[tx.From] -= tx.Fee
+	s.releaseHTLC(htlc, htlc.Recipient)
+	return nil
+}
+
+// applyRefundHTLC returns an expired contract to its sender; callers must
+// hold s.mu
+func (s *State) applyRefundHTLC(tx *Transaction) error {
+	htlc, ok := s.HTLCs[tx.ContractID]
+	if !ok {
+		return fmt.Errorf("no open HTLC %s", tx.ContractID)
+	}
+	if tx.From != htlc.Sender {
+		return fmt.Errorf("only sender %s may refund HTLC %s", htlc.Sender, htlc.ID)
+	}
+	if s.Height < htlc.Expiry {
+		return fmt.Errorf("HTLC %s cannot be refunded before height %d", htlc.ID, htlc.Expiry)
+	}
+
+	s.Balances[tx.From] -= tx.Fee
+	s.releaseHTLC(htlc, htlc.Sender)
+	return nil
+}
+
+// releaseHTLC closes a contract, paying its funds to an address; callers
+// must hold s.mu
+func (s *State) releaseHTLC(htlc HTLC, to string) {
+	delete(s.HTLCs, htlc.ID)
+	ids := s.HashLocks[htlc.HashLock]
+	for i, id := range ids {
+		if id == htlc.ID {
+			ids = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(s.HashLocks, htlc.HashLock)
+	} else {
+		s.HashLocks[htlc.HashLock] = ids
+	}
+	s.touch(htlcKeyPrefix + htlc.ID)
+	if htlc.Asset == "" {
+		s.Balances[to] += htlc.Amount
+		s.touch(to)
+	} else {
+		s.addAssetBalance(to, htlc.Asset, htlc.Amount)
+	}
+}
@@ -0,0 +1,110 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// applyHTLCTx applies a transaction that must be valid and returns whether
+// it executed
+func applyHTLCTx(t *testing.T, state *State, tx *Transaction) bool {
+	t.Helper()
+	receipt, err := state.ApplyTransaction(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return receipt.Status == StatusSuccess
+}
+
+func TestHTLCSwapSharesHashLock(t *testing.T) {
+	keys := newTestKeys(t, 3)
+	alice, bob, mallory := keys[0].Address(), keys[1].Address(), keys[2].Address()
+	state := newTestGenesis(keys).State()
+	secret := []byte("swap secret")
+	hashLock := HashLockOf(secret)
+
+	if !applyHTLCTx(t, state, NewIssueAssetTransaction(testChainID, bob, "SLV", 0, 0, 500, 1, 0)) {
+		t.Fatal("issue failed")
+	}
+
+	// A contract locked to the hash first does not stop others using it
+	front := NewLockHTLCTransaction(testChainID, mallory, alice, "", hashLock, 1, 10, 1, 0)
+	lockA := NewLockHTLCTransaction(testChainID, alice, bob, "", hashLock, 1000, 10, 1, 0)
+	lockB := NewLockHTLCTransaction(testChainID, bob, alice, "SLV", hashLock, 500, 5, 1, 1)
+	for _, tx := range []*Transaction{front, lockA, lockB} {
+		if !applyHTLCTx(t, state, tx) {
+			t.Fatalf("lock %s failed", tx.ID)
+		}
+	}
+	if locked := state.GetHTLCsByHashLock(hashLock); len(locked) != 3 {
+		t.Fatalf("expected 3 contracts locked to the hash, got %d", len(locked))
+	}
+
+	// Alice takes Bob's silver, revealing the secret Bob then uses
+	preimage := hex.EncodeToString(secret)
+	if applyHTLCTx(t, state, NewClaimHTLCTransaction(testChainID, alice, lockB.ID, hex.EncodeToString([]byte("guess")), 1, 1)) {
+		t.Fatal("expected a claim with the wrong preimage to fail")
+	}
+	if !applyHTLCTx(t, state, NewClaimHTLCTransaction(testChainID, alice, lockB.ID, preimage, 1, 2)) {
+		t.Fatal("alice's claim failed")
+	}
+	if !applyHTLCTx(t, state, NewClaimHTLCTransaction(testChainID, bob, lockA.ID, preimage, 1, 2)) {
+		t.Fatal("bob's claim failed")
+	}
+
+	if got := state.GetAssetBalance(alice, "SLV"); got != 500 {
+		t.Errorf("alice holds %d SLV, want 500", got)
+	}
+	if got := state.GetBalance(bob); got != 1000000+1000-3 {
+		t.Errorf("bob's balance is %d, want %d", got, 1000000+1000-3)
+	}
+	if _, open := state.GetHTLC(lockA.ID); open {
+		t.Error("claimed contract is still open")
+	}
+	if locked := state.GetHTLCsByHashLock(hashLock); len(locked) != 1 || locked[0].ID != front.ID {
+		t.Fatalf("expected only the front-running contract left, got %v", locked)
+	}
+}
+
+func TestHTLCRefundByID(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	alice, bob := keys[0].Address(), keys[1].Address()
+	state := newTestGenesis(keys).State()
+	hashLock := HashLockOf([]byte("secret"))
+
+	first := NewLockHTLCTransaction(testChainID, alice, bob, "", hashLock, 100, 5, 1, 0)
+	second := NewLockHTLCTransaction(testChainID, alice, bob, "", hashLock, 200, 5, 1, 1)
+	applyHTLCTx(t, state, first)
+	applyHTLCTx(t, state, second)
+
+	if applyHTLCTx(t, state, NewRefundHTLCTransaction(testChainID, alice, first.ID, 1, 2)) {
+		t.Fatal("expected a refund before expiry to fail")
+	}
+	state.Height = 5
+	if applyHTLCTx(t, state, NewRefundHTLCTransaction(testChainID, bob, first.ID, 1, 0)) {
+		t.Fatal("expected a refund by the recipient to fail")
+	}
+	before := state.GetBalance(alice)
+	if !applyHTLCTx(t, state, NewRefundHTLCTransaction(testChainID, alice, first.ID, 1, 3)) {
+		t.Fatal("refund failed")
+	}
+	if got := state.GetBalance(alice); got != before+100-1 {
+		t.Errorf("alice's balance is %d, want %d", got, before+100-1)
+	}
+	if _, open := state.GetHTLC(second.ID); !open {
+		t.Error("refunding one contract closed another with the same hash lock")
+	}
+}
+
+func TestHTLCFieldsByType(t *testing.T) {
+	refund := NewRefundHTLCTransaction(testChainID, "alice", "id", 1, 0)
+	refund.HashLock = HashLockOf([]byte("secret"))
+	if err := refund.checkFields(); err == nil {
+		t.Error("expected a refund with a hash lock to be rejected")
+	}
+	lock := NewLockHTLCTransaction(testChainID, "alice", "bob", "", HashLockOf([]byte("secret")), 1, 5, 1, 0)
+	lock.ContractID = "id"
+	if err := lock.checkFields(); err == nil {
+		t.Error("expected a lock with a contract ID to be rejected")
+	}
+}
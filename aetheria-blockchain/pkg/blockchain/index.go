@@ -0,0 +1,88 @@
+package blockchain
+
+// TxLocation identifies where a transaction sits in the chain
+type TxLocation struct {
+	Height   uint64 `json:"height"`
+	Position int    `json:"position"`
+}
+
+// chainIndex holds lookup tables over the canonical chain. It is not
+// synchronized on its own; the owning Blockchain's lock guards it.
+type chainIndex struct {
+	blockHeights map[string]uint64     // block hash -> height
+	txLocations  map[string]TxLocation // tx ID -> location
+	addressTxs   map[string][]string   // address -> tx IDs, oldest first
+}
+
+// newChainIndex creates an empty index
+func newChainIndex() *chainIndex {
+	return &chainIndex{
+		blockHeights: make(map[string]uint64),
+		txLocations:  make(map[string]TxLocation),
+		addressTxs:   make(map[string][]string),
+	}
+}
+
+// addBlock indexes a block appended to the canonical chain
+func (ci *chainIndex) addBlock(block *Block) {
+	ci.blockHeights[block.Hash] = block.Index
+
+	for i, tx := range block.Transactions {
+		ci.txLocations[tx.ID] = TxLocation{Height: block.Index, Position: i}
+
+		if tx.From != "" {
+			ci.addressTxs[tx.From] = append(ci.addressTxs[tx.From], tx.ID)
+		}
+		if tx.To != "" && tx.To != tx.From {
+			ci.addressTxs[tx.To] = append(ci.addressTxs[tx.To], tx.ID)
+		}
+	}
+}
+
+// removeBlock unindexes the current tip of the canonical chain during a
+// reorganization. Blocks must be removed newest first.
+func (ci *chainIndex) removeBlock(block *Block) {
+	delete(ci.blockHeights, block.Hash)
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		if loc, ok := ci.txLocations[tx.ID]; ok && loc.Height == block.Index {
+			delete(ci.txLocations, tx.ID)
+		}
+
+		ci.popAddressTx(tx.To, tx.ID)
+		if tx.From != tx.To {
+			ci.popAddressTx(tx.From, tx.ID)
+		}
+	}
+}
+
+// popAddressTx removes txID from the end of an address's history
+func (ci *chainIndex) popAddressTx(address, txID string) {
+	ids := ci.addressTxs[address]
+	if len(ids) == 0 || ids[len(ids)-1] != txID {
+		return
+	}
+	if len(ids) == 1 {
+		delete(ci.addressTxs, address)
+		return
+	}
+	ci.addressTxs[address] = ids[:len(ids)-1]
+}
+
+// blockHeight returns the height of the block with the given hash
+func (ci *chainIndex) blockHeight(hash string) (uint64, bool) {
+	height, ok := ci.blockHeights[hash]
+	return height, ok
+}
+
+// txLocation returns the location of a transaction
+func (ci *chainIndex) txLocation(txID string) (TxLocation, bool) {
+	loc, ok := ci.txLocations[txID]
+	return loc, ok
+}
+
+// addressHistory returns the transaction IDs touching an address
+func (ci *chainIndex) addressHistory(address string) []string {
+	return ci.addressTxs[address]
+}
@@ -0,0 +1,306 @@
+package blockchain
+
+import (
+	"container/heap"
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/aetheria/blockchain/pkg/events"
+)
+
+// MempoolConfig limits what the mempool holds
+type MempoolConfig struct {
+	MaxSize      int           // transactions held in total (0 means unlimited)
+	MaxPerSender int           // transactions held per sender (0 means unlimited)
+	Expiry       time.Duration // how long a transaction may wait (0 means forever)
+	PriceBump    uint64        // minimum fee increase, in percent, to replace a transaction
+}
+
+// DefaultMempoolConfig returns the default mempool limits
+func DefaultMempoolConfig() MempoolConfig {
+	return MempoolConfig{
+		MaxSize:      5000,
+		MaxPerSender: 64,
+		Expiry:       3 * time.Hour,
+		PriceBump:    10,
+	}
+}
+
+// poolEntry is a transaction held in the mempool
+type poolEntry struct {
+	tx    *Transaction
+	size  uint64 // tx.Size(), cached
+	added time.Time
+}
+
+// newPoolEntry wraps a transaction arriving now
+func newPoolEntry(tx *Transaction) *poolEntry {
+	return &poolEntry{tx: tx, size: uint64(tx.Size()), added: time.Now()}
+}
+
+// paysMoreThan reports whether e offers a higher fee per byte than other
+func (e *poolEntry) paysMoreThan(other *poolEntry) bool {
+	// Compare e.fee/e.size with other.fee/other.size without dividing
+	hi1, lo1 := bits.Mul64(e.tx.Fee, other.size)
+	hi2, lo2 := bits.Mul64(other.tx.Fee, e.size)
+	return hi1 > hi2 || (hi1 == hi2 && lo1 > lo2)
+}
+
+// Mempool holds unconfirmed transactions. Transactions whose nonce follows
+// the sender's state nonce without gaps are pending and can be mined; the
+// rest are queued until the gap is filled. Pending transactions are offered
+// to block producers highest fee per byte first, in nonce order per sender.
+type Mempool struct {
+	config  MempoolConfig
+	all     map[string]*poolEntry            // tx ID -> entry
+	senders map[string]map[uint64]*poolEntry // sender -> nonce -> entry
+	events  *events.Bus                      // where additions and evictions are published, if set
+	mu      sync.RWMutex
+}
+
+// NewMempool creates an empty mempool
+func NewMempool(config MempoolConfig) *Mempool {
+	return &Mempool{
+		config:  config,
+		all:     make(map[string]*poolEntry),
+		senders: make(map[string]map[uint64]*poolEntry),
+	}
+}
+
+// Add validates a transaction against state and adds it to the pool. A
+// transaction reusing a pooled sender and nonce replaces the pooled one if
+// its fee is at least PriceBump percent higher. When the pool is full, the
+// transaction paying the lowest fee per byte is evicted to make room for one
+// paying more. Additions and evictions are published as TxAddedEvent and
+// TxEvictedEvent.
+func (mp *Mempool) Add(tx *Transaction, state *State) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.prune(time.Now())
+
+	if _, exists := mp.all[tx.ID]; exists {
+		return fmt.Errorf("transaction already exists")
+	}
+	if err := tx.checkCost(); err != nil {
+		return err
+	}
+
+	// Check nonce
+	stateNonce := state.GetNonce(tx.From)
+	if tx.Nonce < stateNonce {
+		return fmt.Errorf("nonce too low: expected at least %d, got %d", stateNonce, tx.Nonce)
+	}
+
+	// Check balance
+	balance := state.GetBalance(tx.From)
+	totalRequired := tx.Cost()
+	if balance < totalRequired {
+		return fmt.Errorf("insufficient balance: has %d, needs %d", balance, totalRequired)
+	}
+
+	// Replace a pooled transaction with the same nonce
+	if old, exists := mp.senders[tx.From][tx.Nonce]; exists {
+		minFee := max(old.tx.Fee+old.tx.Fee*mp.config.PriceBump/100, old.tx.Fee+1)
+		if tx.Fee < minFee {
+			return fmt.Errorf("replacement fee too low: has %d, needs at least %d", tx.Fee, minFee)
+		}
+		mp.remove(old.tx)
+		mp.insert(tx)
+		mp.events.Publish(TxEvictedEvent{Tx: old.tx, Reason: EvictReplaced})
+		mp.events.Publish(TxAddedEvent{Tx: tx})
+		return nil
+	}
+
+	if mp.config.MaxPerSender > 0 && len(mp.senders[tx.From]) >= mp.config.MaxPerSender {
+		return fmt.Errorf("sender %s already has %d transactions in the pool", tx.From, len(mp.senders[tx.From]))
+	}
+	if mp.config.MaxSize > 0 && len(mp.all) >= mp.config.MaxSize {
+		victim := mp.evictionCandidate(tx.From)
+		if victim == nil || !newPoolEntry(tx).paysMoreThan(victim) {
+			return fmt.Errorf("mempool is full")
+		}
+		mp.remove(victim.tx)
+		mp.events.Publish(TxEvictedEvent{Tx: victim.tx, Reason: EvictPoolFull})
+	}
+
+	mp.insert(tx)
+	mp.events.Publish(TxAddedEvent{Tx: tx})
+	return nil
+}
+
+// evictionCandidate returns the lowest fee-per-byte transaction that can be
+// dropped without leaving a nonce gap (the highest-nonce transaction of a
+// sender other than exclude), preferring the newest on equal rates; callers
+// must hold mp.mu
+func (mp *Mempool) evictionCandidate(exclude string) *poolEntry {
+	var victim *poolEntry
+	for sender, entries := range mp.senders {
+		if sender == exclude {
+			continue
+		}
+		var last *poolEntry
+		for _, entry := range entries {
+			if last == nil || entry.tx.Nonce > last.tx.Nonce {
+				last = entry
+			}
+		}
+		if victim == nil || victim.paysMoreThan(last) ||
+			(!last.paysMoreThan(victim) && last.added.After(victim.added)) {
+			victim = last
+		}
+	}
+	return victim
+}
+
+// insert adds a transaction; callers must hold mp.mu
+func (mp *Mempool) insert(tx *Transaction) {
+	entry := newPoolEntry(tx)
+	mp.all[tx.ID] = entry
+	if mp.senders[tx.From] == nil {
+		mp.senders[tx.From] = make(map[uint64]*poolEntry)
+	}
+	mp.senders[tx.From][tx.Nonce] = entry
+}
+
+// remove drops a transaction; callers must hold mp.mu
+func (mp *Mempool) remove(tx *Transaction) {
+	delete(mp.all, tx.ID)
+	delete(mp.senders[tx.From], tx.Nonce)
+	if len(mp.senders[tx.From]) == 0 {
+		delete(mp.senders, tx.From)
+	}
+}
+
+// prune drops expired transactions; callers must hold mp.mu
+func (mp *Mempool) prune(now time.Time) {
+	if mp.config.Expiry <= 0 {
+		return
+	}
+	for _, entry := range mp.all {
+		if now.Sub(entry.added) > mp.config.Expiry {
+			mp.remove(entry.tx)
+			mp.events.Publish(TxEvictedEvent{Tx: entry.tx, Reason: EvictExpired})
+		}
+	}
+}
+
+// Reset drops transactions made stale by a new head state (mined, or
+// replaced by a mined transaction with the same nonce) and expired ones.
+// Everything else stays in the pool. It returns the stale transactions, for
+// the caller to tell mined ones from replaced ones.
+func (mp *Mempool) Reset(state *State) []*Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var stale []*Transaction
+	for sender, entries := range mp.senders {
+		stateNonce := state.GetNonce(sender)
+		for nonce, entry := range entries {
+			if nonce < stateNonce {
+				mp.remove(entry.tx)
+				stale = append(stale, entry.tx)
+			}
+		}
+	}
+	mp.prune(time.Now())
+	return stale
+}
+
+// Get returns a pooled transaction by ID
+func (mp *Mempool) Get(txID string) (*Transaction, bool) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	entry, ok := mp.all[txID]
+	if !ok {
+		return nil, false
+	}
+	return entry.tx, true
+}
+
+// Len returns the number of pooled transactions, pending and queued
+func (mp *Mempool) Len() int {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return len(mp.all)
+}
+
+// NextNonce returns the nonce following the sender's pending transactions
+func (mp *Mempool) NextNonce(address string, state *State) uint64 {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	nonce := state.GetNonce(address)
+	for {
+		if _, ok := mp.senders[address][nonce]; !ok {
+			return nonce
+		}
+		nonce++
+	}
+}
+
+// Pending returns the transactions executable on top of state, highest fee
+// per byte first while keeping each sender's transactions in nonce order
+func (mp *Mempool) Pending(state *State) []*Transaction {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	next := make(map[string]uint64, len(mp.senders))
+	heads := &feeHeap{}
+	for sender, entries := range mp.senders {
+		nonce := state.GetNonce(sender)
+		if entry, ok := entries[nonce]; ok {
+			next[sender] = nonce + 1
+			heads.entries = append(heads.entries, entry)
+		}
+	}
+	heap.Init(heads)
+
+	pending := make([]*Transaction, 0, len(mp.all))
+	for heads.Len() > 0 {
+		entry := heap.Pop(heads).(*poolEntry)
+		pending = append(pending, entry.tx)
+
+		sender := entry.tx.From
+		if following, ok := mp.senders[sender][next[sender]]; ok {
+			next[sender]++
+			heap.Push(heads, following)
+		}
+	}
+	return pending
+}
+
+// feeHeap orders pool entries by fee per byte, highest first, then by
+// arrival
+type feeHeap struct {
+	entries []*poolEntry
+}
+
+func (h *feeHeap) Len() int { return len(h.entries) }
+
+func (h *feeHeap) Less(i, j int) bool {
+	a, b := h.entries[i], h.entries[j]
+	if a.paysMoreThan(b) {
+		return true
+	}
+	if b.paysMoreThan(a) {
+		return false
+	}
+	if !a.added.Equal(b.added) {
+		return a.added.Before(b.added)
+	}
+	return a.tx.ID < b.tx.ID
+}
+
+func (h *feeHeap) Swap(i, j int) { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+
+func (h *feeHeap) Push(x interface{}) { h.entries = append(h.entries, x.(*poolEntry)) }
+
+func (h *feeHeap) Pop() interface{} {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
@@ -0,0 +1,205 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestMempool returns a pool with config and a state funding every key
+func newTestMempool(t *testing.T, config MempoolConfig, senders int) (*Mempool, *State, []string) {
+	t.Helper()
+	keys := newTestKeys(t, senders)
+	addresses := make([]string, len(keys))
+	for i, keyPair := range keys {
+		addresses[i] = keyPair.Address()
+	}
+	return NewMempool(config), newTestGenesis(keys).State(), addresses
+}
+
+// selfTransfer returns a transfer of 1 from sender to itself
+func selfTransfer(sender string, fee, nonce uint64) *Transaction {
+	return NewTransaction(testChainID, sender, sender, 1, fee, nonce)
+}
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	mp, state, senders := newTestMempool(t, DefaultMempoolConfig(), 1)
+	original := selfTransfer(senders[0], 100, 0)
+	if err := mp.Add(original, state); err != nil {
+		t.Fatal(err)
+	}
+
+	// PriceBump is 10%, so 110 is the least a replacement may pay
+	if err := mp.Add(selfTransfer(senders[0], 109, 0), state); err == nil {
+		t.Fatal("expected a replacement paying less than the price bump to be refused")
+	}
+	replacement := selfTransfer(senders[0], 110, 0)
+	if err := mp.Add(replacement, state); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mp.Get(original.ID); ok {
+		t.Fatal("replaced transaction is still pooled")
+	}
+	if _, ok := mp.Get(replacement.ID); !ok || mp.Len() != 1 {
+		t.Fatalf("expected only the replacement pooled, got %d transactions", mp.Len())
+	}
+
+	// Even a zero fee needs some increase to be replaced
+	if err := mp.Add(selfTransfer(senders[0], 0, 1), state); err != nil {
+		t.Fatal(err)
+	}
+	if err := mp.Add(selfTransfer(senders[0], 0, 1), state); err == nil {
+		t.Fatal("expected an identical zero-fee replacement to be refused")
+	}
+}
+
+func TestMempoolEvictsLowestFeeWhenFull(t *testing.T) {
+	config := DefaultMempoolConfig()
+	config.MaxSize = 3
+	mp, state, senders := newTestMempool(t, config, 4)
+
+	cheap := selfTransfer(senders[0], 10, 0)
+	for _, tx := range []*Transaction{cheap, selfTransfer(senders[1], 20, 0), selfTransfer(senders[2], 30, 0)} {
+		if err := mp.Add(tx, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mp.Add(selfTransfer(senders[3], 5, 0), state); err == nil {
+		t.Fatal("expected a full pool to refuse a transaction paying less than any pooled one")
+	}
+	if err := mp.Add(selfTransfer(senders[3], 40, 0), state); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mp.Get(cheap.ID); ok {
+		t.Fatal("expected the cheapest transaction to be evicted")
+	}
+	if mp.Len() != 3 {
+		t.Fatalf("pool holds %d transactions, want 3", mp.Len())
+	}
+}
+
+func TestMempoolEvictionLeavesNoNonceGap(t *testing.T) {
+	config := DefaultMempoolConfig()
+	config.MaxSize = 3
+	mp, state, senders := newTestMempool(t, config, 3)
+
+	// Sender 0's cheap first transaction can't go while its second stays
+	first, second := selfTransfer(senders[0], 1, 0), selfTransfer(senders[0], 100, 1)
+	middle := selfTransfer(senders[1], 50, 0)
+	for _, tx := range []*Transaction{first, second, middle} {
+		if err := mp.Add(tx, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mp.Add(selfTransfer(senders[2], 60, 0), state); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mp.Get(middle.ID); ok {
+		t.Fatal("expected the cheapest last transaction of a sender to be evicted")
+	}
+	for _, tx := range []*Transaction{first, second} {
+		if _, ok := mp.Get(tx.ID); !ok {
+			t.Fatalf("transaction with nonce %d was evicted", tx.Nonce)
+		}
+	}
+}
+
+func TestMempoolSenderKeepsOwnTransactions(t *testing.T) {
+	config := DefaultMempoolConfig()
+	config.MaxSize = 2
+	mp, state, senders := newTestMempool(t, config, 2)
+	own, other := selfTransfer(senders[0], 1, 0), selfTransfer(senders[1], 50, 0)
+	for _, tx := range []*Transaction{own, other} {
+		if err := mp.Add(tx, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The cheapest transaction is the sender's own, which its next one needs
+	if err := mp.Add(selfTransfer(senders[0], 1000, 1), state); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mp.Get(other.ID); ok {
+		t.Fatal("expected another sender's transaction to be evicted")
+	}
+	if mp.NextNonce(senders[0], state) != 2 {
+		t.Fatalf("expected sender 0 to continue at nonce 2, got %d", mp.NextNonce(senders[0], state))
+	}
+}
+
+func TestMempoolPendingOrder(t *testing.T) {
+	mp, state, senders := newTestMempool(t, DefaultMempoolConfig(), 3)
+	txs := []*Transaction{
+		selfTransfer(senders[0], 10, 0),
+		selfTransfer(senders[0], 90, 1),
+		selfTransfer(senders[1], 50, 0),
+		selfTransfer(senders[2], 70, 1), // queued behind a missing nonce 0
+	}
+	for _, tx := range txs {
+		if err := mp.Add(tx, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sender 1 pays more per byte than sender 0's first transaction, which
+	// must still come before its second
+	want := []*Transaction{txs[2], txs[0], txs[1]}
+	pending := mp.Pending(state)
+	if len(pending) != len(want) {
+		t.Fatalf("expected %d pending transactions, got %d", len(want), len(pending))
+	}
+	for i, tx := range want {
+		if pending[i].ID != tx.ID {
+			t.Fatalf("pending[%d] is nonce %d from %s, want nonce %d from %s", i, pending[i].Nonce, pending[i].From, tx.Nonce, tx.From)
+		}
+	}
+}
+
+func TestMempoolLimitsPerSender(t *testing.T) {
+	config := DefaultMempoolConfig()
+	config.MaxPerSender = 2
+	mp, state, senders := newTestMempool(t, config, 1)
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		if err := mp.Add(selfTransfer(senders[0], 1, nonce), state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mp.Add(selfTransfer(senders[0], 1, 2), state); err == nil {
+		t.Fatal("expected a sender over its limit to be refused")
+	}
+	if err := mp.Add(selfTransfer(senders[0], 2, 1), state); err != nil {
+		t.Fatalf("expected a sender at its limit to still replace: %v", err)
+	}
+}
+
+func TestMempoolResetAndExpiry(t *testing.T) {
+	mp, state, senders := newTestMempool(t, DefaultMempoolConfig(), 2)
+	mined, kept := selfTransfer(senders[0], 1, 0), selfTransfer(senders[0], 1, 1)
+	old := selfTransfer(senders[1], 1, 0)
+	for _, tx := range []*Transaction{mined, kept, old} {
+		if err := mp.Add(tx, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	next := state.Clone()
+	if _, err := next.ApplyTransaction(mined); err != nil {
+		t.Fatal(err)
+	}
+	mp.all[old.ID].added = time.Now().Add(-mp.config.Expiry - time.Minute)
+
+	stale := mp.Reset(next)
+	if len(stale) != 1 || stale[0].ID != mined.ID {
+		t.Fatalf("expected only the mined transaction to be stale, got %d", len(stale))
+	}
+	if _, ok := mp.Get(old.ID); ok {
+		t.Fatal("expired transaction is still pooled")
+	}
+	if _, ok := mp.Get(kept.ID); !ok || mp.Len() != 1 {
+		t.Fatalf("expected only the unmined transaction left, got %d", mp.Len())
+	}
+	if err := mp.Add(mined, next); err == nil {
+		t.Fatal("expected a mined nonce to be refused")
+	}
+}
@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/aetheria/blockchain/pkg/monetary"
+)
+
+const (
+	// DefaultUnbondingPeriod is the default number of blocks unstaked funds
+	// stay locked before they become spendable
+	DefaultUnbondingPeriod = 100
+	// DefaultSlashFraction is the default share of a double-signer's bonded
+	// stake that is slashed, in basis points
+	DefaultSlashFraction = 500
+	// DefaultSlashRewardShare is the default share of slashed stake paid to
+	// the proposer including the evidence, in basis points; the rest is burned
+	DefaultSlashRewardShare = 1000
+	// DefaultMaxBlockBytes is the default limit on a block's size, as
+	// returned by Block.Size
+	DefaultMaxBlockBytes = 1 << 20
+	// DefaultMaxBlockTxs is the default limit on the number of transactions
+	// in a block, coinbase included
+	DefaultMaxBlockTxs = 5000
+	// DefaultEpochLength is the default number of blocks in an epoch
+	DefaultEpochLength = 100
+	// DefaultMaxValidators is the default size limit of the active
+	// validator set
+	DefaultMaxValidators = 100
+	// DefaultMinValidatorStake is the default least own stake a validator
+	// must have bonded to be elected
+	DefaultMinValidatorStake = MinStakeAmount
+	// DefaultSlotDuration is the default length of a block slot in seconds
+	DefaultSlotDuration = 5
+)
+
+// Params are consensus parameters that every node on a network must agree on
+type Params struct {
+	UnbondingPeriod   uint64          `json:"unbonding_period"`    // blocks between unstaking and withdrawal
+	SlashFraction     uint64          `json:"slash_fraction"`      // basis points of bonded stake slashed for double-signing
+	SlashRewardShare  uint64          `json:"slash_reward_share"`  // basis points of slashed stake paid to the proposer
+	MaxBlockBytes     uint64          `json:"max_block_bytes"`     // largest block size in bytes (0 means unlimited)
+	MaxBlockTxs       uint64          `json:"max_block_txs"`       // most transactions per block (0 means unlimited)
+	EpochLength       uint64          `json:"epoch_length"`        // blocks per validator set election (0 means every block)
+	MaxValidators     uint64          `json:"max_validators"`      // size of the active validator set (0 means unlimited)
+	MinValidatorStake uint64          `json:"min_validator_stake"` // least own stake a validator needs to be elected
+	SlotDuration      uint64          `json:"slot_duration"`       // seconds per slot, each with one elected proposer
+	Monetary          monetary.Policy `json:"monetary"`            // block rewards and fee burning
+}
+
+// DefaultParams returns the default consensus parameters
+func DefaultParams() Params {
+	return Params{
+		UnbondingPeriod:   DefaultUnbondingPeriod,
+		SlashFraction:     DefaultSlashFraction,
+		SlashRewardShare:  DefaultSlashRewardShare,
+		MaxBlockBytes:     DefaultMaxBlockBytes,
+		MaxBlockTxs:       DefaultMaxBlockTxs,
+		EpochLength:       DefaultEpochLength,
+		MaxValidators:     DefaultMaxValidators,
+		MinValidatorStake: DefaultMinValidatorStake,
+		SlotDuration:      DefaultSlotDuration,
+		Monetary:          monetary.DefaultPolicy(),
+	}
+}
+
+// checkBlockLimits reports whether a block exceeds the size or transaction
+// count limits
+func (p Params) checkBlockLimits(block *Block) error {
+	if p.MaxBlockTxs > 0 && uint64(len(block.Transactions)) > p.MaxBlockTxs {
+		return fmt.Errorf("block has %d transactions, limit is %d", len(block.Transactions), p.MaxBlockTxs)
+	}
+	if size := uint64(block.Size()); p.MaxBlockBytes > 0 && size > p.MaxBlockBytes {
+		return fmt.Errorf("block is %d bytes, limit is %d", size, p.MaxBlockBytes)
+	}
+	return nil
+}
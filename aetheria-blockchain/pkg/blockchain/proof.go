@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// TxProof proves that a transaction is included in a block. A light wallet
+// that trusts BlockHash (and therefore TxRoot) can check it offline with
+// VerifyTxProof, without downloading the block.
+type TxProof struct {
+	TxID       string                   `json:"tx_id"`
+	BlockIndex uint64                   `json:"block_index"`
+	BlockHash  string                   `json:"block_hash"`
+	TxRoot     string                   `json:"tx_root"`
+	Position   int                      `json:"position"`
+	Path       []crypto.MerkleProofStep `json:"path"`
+}
+
+// NewTxProof builds an inclusion proof for the transaction at position in block
+func NewTxProof(block *Block, position int) (*TxProof, error) {
+	if position < 0 || position >= len(block.Transactions) {
+		return nil, fmt.Errorf("transaction position %d out of range", position)
+	}
+
+	path, err := crypto.MerkleProof(block.txLeaves(), position)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxProof{
+		TxID:       block.Transactions[position].ID,
+		BlockIndex: block.Index,
+		BlockHash:  block.Hash,
+		TxRoot:     block.TxRoot,
+		Position:   position,
+		Path:       path,
+	}, nil
+}
+
+// Verify checks the proof against its own TxRoot
+func (p *TxProof) Verify() error {
+	return VerifyTxProof(p.TxID, p.TxRoot, p.Path)
+}
+
+// VerifyTxProof checks that txID is included under the transaction root txRoot
+func VerifyTxProof(txID, txRoot string, path []crypto.MerkleProofStep) error {
+	root, err := hex.DecodeString(txRoot)
+	if err != nil {
+		return fmt.Errorf("invalid transaction root: %w", err)
+	}
+	if !crypto.VerifyMerkleProof(root, txLeaf(txID), path) {
+		return fmt.Errorf("transaction %s is not included under root %s", txID, txRoot)
+	}
+	return nil
+}
+
+// AccountProof proves an account's balance, stake and nonce against the
+// state root committed in a block
+type AccountProof struct {
+	Address    string                    `json:"address"`
+	Account    *Account                  `json:"account"`
+	BlockIndex uint64                    `json:"block_index"`
+	BlockHash  string                    `json:"block_hash"`
+	StateRoot  string                    `json:"state_root"`
+	Proof      *crypto.SparseMerkleProof `json:"proof"`
+}
+
+// Verify checks the proof against its own StateRoot
+func (p *AccountProof) Verify() error {
+	return VerifyAccountProof(p.StateRoot, p.Address, p.Account, p.Proof)
+}
+
+// VerifyAccountProof checks that address holds account under stateRoot.
+// An empty account is verified as absent from the tree.
+func VerifyAccountProof(stateRoot, address string, account *Account, proof *crypto.SparseMerkleProof) error {
+	root, err := hex.DecodeString(stateRoot)
+	if err != nil {
+		return fmt.Errorf("invalid state root: %w", err)
+	}
+	if proof == nil {
+		return fmt.Errorf("missing proof")
+	}
+
+	var value []byte
+	if account != nil && !account.IsEmpty() {
+		value = account.Encode()
+	}
+	if err := crypto.VerifySparseMerkleProof(root, []byte(address), value, proof); err != nil {
+		return fmt.Errorf("account proof for %s is invalid: %w", address, err)
+	}
+	return nil
+}
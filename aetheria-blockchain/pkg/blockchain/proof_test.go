@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestAccountProofsAtPastHeights(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	validator, recipient := keys[:1], keys[1].Address()
+	bc := newTestChain(t, newTestGenesis(keys[:1]), NewMemoryBlockStore(), nil)
+
+	for i := 0; i < 5; i++ {
+		tx := NewTransaction(testChainID, validator[0].Address(), recipient, 100, 10, uint64(i))
+		if err := tx.Sign(validator[0].PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		mineBlock(t, bc, validator)
+	}
+
+	for height := uint64(0); height <= 5; height++ {
+		proof, err := bc.GetAccountProof(recipient, height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof.StateRoot != bc.GetBlock(height).StateRoot {
+			t.Fatalf("block %d: proof against root %s, want the block's %s", height, proof.StateRoot, bc.GetBlock(height).StateRoot)
+		}
+		if err := proof.Verify(); err != nil {
+			t.Fatalf("block %d: %v", height, err)
+		}
+		if want := 100 * height; proof.Account.Balance != want {
+			t.Fatalf("block %d: balance %d, want %d", height, proof.Account.Balance, want)
+		}
+
+		// The same proof does not vouch for another balance
+		forged := *proof.Account
+		forged.Balance++
+		if err := VerifyAccountProof(proof.StateRoot, recipient, &forged, proof.Proof); err == nil {
+			t.Fatalf("block %d: expected a forged balance to fail", height)
+		}
+	}
+}
+
+func TestStateRootMatchesFullRebuild(t *testing.T) {
+	keys := newTestKeys(t, 3)
+	state := newTestGenesis(keys).State()
+	state.Root()
+	alice, bob, carol := keys[0].Address(), keys[1].Address(), keys[2].Address()
+
+	txs := []*Transaction{
+		NewTransaction(testChainID, alice, bob, 500, 1, 0),
+		NewIssueAssetTransaction(testChainID, bob, "GLD", 0, 0, 100, 1, 0),
+		NewTransferAssetTransaction(testChainID, bob, carol, "GLD", 40, 1, 1),
+		NewLockHTLCTransaction(testChainID, carol, alice, "", HashLockOf([]byte("secret")), 50, 10, 1, 0),
+		NewDelegateTransaction(testChainID, alice, carol, 1000, 1, 1),
+		NewUnstakeTransaction(testChainID, bob, 1, 1, 2),
+	}
+	for _, tx := range txs {
+		receipt, err := state.ApplyTransaction(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt.Status != StatusSuccess {
+			t.Fatalf("%s failed", tx.Type)
+		}
+
+		// The root updated key by key equals one built from scratch
+		root := state.Root()
+		state.mu.RLock()
+		full := state.buildTree().Root()
+		state.mu.RUnlock()
+		if root != hex.EncodeToString(full) {
+			t.Fatalf("after %s: incremental root %s, want %x", tx.Type, root, full)
+		}
+	}
+}
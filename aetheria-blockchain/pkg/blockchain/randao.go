@@ -0,0 +1,164 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/aetheria/blockchain/pkg/codec"
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// randaoSecretSize is the length of a beacon secret in bytes
+const randaoSecretSize = sha256.Size
+
+// RandaoCommitment is a validator's commitment to the secret it must reveal
+// in the next block it proposes
+type RandaoCommitment struct {
+	Hash   string `json:"hash"`   // hex SHA-256 of the secret
+	Height uint64 `json:"height"` // block that made the commitment
+}
+
+// RandaoSecret derives the beacon secret a validator commits to in its block
+// at height. Deriving it from the private key lets a restarted node reveal
+// what it committed to without storing anything.
+func RandaoSecret(privateKey []byte, chainID string, height uint64) []byte {
+	enc := codec.NewEncoder()
+	enc.WriteString("randao")
+	enc.WriteString(chainID)
+	enc.WriteUint64(height)
+
+	mac := hmac.New(sha256.New, privateKey)
+	mac.Write(enc.Bytes())
+	return mac.Sum(nil)
+}
+
+// Slot returns the slot a timestamp falls in. Slots are SlotDuration seconds
+// long and counted from the genesis time, which is slot 0.
+func (p Params) Slot(genesisTime, timestamp int64) uint64 {
+	if p.SlotDuration == 0 || timestamp <= genesisTime {
+		return 0
+	}
+	return uint64(timestamp-genesisTime) / p.SlotDuration
+}
+
+// SlotTime returns the start of a slot, which is the timestamp of a block
+// proposed in it
+func (p Params) SlotTime(genesisTime int64, slot uint64) int64 {
+	return genesisTime + int64(slot*p.SlotDuration)
+}
+
+// GetRandaoMix returns the beacon output, the hash accumulated over every
+// secret revealed so far
+func (s *State) GetRandaoMix() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.RandaoMix
+}
+
+// GetRandaoCommitment returns a validator's outstanding beacon commitment
+func (s *State) GetRandaoCommitment(address string) (RandaoCommitment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	commitment, ok := s.RandaoCommits[address]
+	return commitment, ok
+}
+
+// SlotLeader returns the validator elected to propose the block of a slot
+// built on this state. The seed hashes the beacon mix with the slot, and the
+// leader is drawn from the active set weighted by voting power. The mix only
+// changes by validators revealing secrets committed to earlier, so the
+// proposer of the parent block can no more pick the next leader than skip
+// its turn.
+func (s *State) SlotLeader(slot uint64) (string, error) {
+	leader, err := s.slotLeader(slot)
+	if err != nil {
+		return "", err
+	}
+	return leader.Address, nil
+}
+
+// slotLeader returns the active validator SlotLeader elects for a slot
+func (s *State) slotLeader(slot uint64) (ActiveValidator, error) {
+	validators := s.ActiveValidators()
+	var total uint64
+	for _, v := range validators {
+		total += v.Power()
+	}
+	if total == 0 {
+		return ActiveValidator{}, fmt.Errorf("no active validators to lead slot %d", slot)
+	}
+
+	mix, err := hex.DecodeString(s.GetRandaoMix())
+	if err != nil {
+		return ActiveValidator{}, fmt.Errorf("invalid randao mix: %w", err)
+	}
+	seed := make([]byte, len(mix)+8)
+	copy(seed, mix)
+	binary.BigEndian.PutUint64(seed[len(mix):], slot)
+	hash := sha256.Sum256(seed)
+
+	target := new(big.Int).Mod(new(big.Int).SetBytes(hash[:]), new(big.Int).SetUint64(total)).Uint64()
+	var cumulative uint64
+	for _, v := range validators {
+		cumulative += v.Power()
+		if target < cumulative {
+			return v, nil
+		}
+	}
+	return validators[len(validators)-1], nil
+}
+
+// randaoContribution returns the reveal and commitment the block at height
+// proposed by validator must carry: the secret it committed to in its
+// previous block, if any, and the hash of a fresh secret
+func (s *State) randaoContribution(validator string, privateKey []byte, chainID string, height uint64) (string, string) {
+	var reveal string
+	if commitment, ok := s.GetRandaoCommitment(validator); ok {
+		reveal = hex.EncodeToString(RandaoSecret(privateKey, chainID, commitment.Height))
+	}
+	commit := crypto.HashString(RandaoSecret(privateKey, chainID, height))
+	return reveal, commit
+}
+
+// applyRandao checks a block's beacon fields against its proposer's
+// commitment, mixes the revealed secret into the beacon and records the
+// block's new commitment. A proposer without a commitment reveals nothing.
+func (s *State) applyRandao(block *Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	commit, err := hex.DecodeString(block.RandaoCommit)
+	if err != nil || len(commit) != sha256.Size {
+		return fmt.Errorf("invalid randao commitment %q", block.RandaoCommit)
+	}
+
+	previous, committed := s.RandaoCommits[block.Validator]
+	if !committed {
+		if block.RandaoReveal != "" {
+			return fmt.Errorf("validator %s revealed a randao secret it never committed to", block.Validator)
+		}
+	} else {
+		reveal, err := hex.DecodeString(block.RandaoReveal)
+		if err != nil || len(reveal) != randaoSecretSize {
+			return fmt.Errorf("invalid randao reveal %q", block.RandaoReveal)
+		}
+		hash := sha256.Sum256(reveal)
+		if want, _ := hex.DecodeString(previous.Hash); !bytes.Equal(hash[:], want) {
+			return fmt.Errorf("randao reveal does not match the commitment made at height %d", previous.Height)
+		}
+
+		mix, err := hex.DecodeString(s.RandaoMix)
+		if err != nil {
+			return fmt.Errorf("invalid randao mix: %w", err)
+		}
+		s.RandaoMix = crypto.HashString(append(mix, reveal...))
+	}
+
+	s.RandaoCommits[block.Validator] = RandaoCommitment{Hash: block.RandaoCommit, Height: block.Index}
+	return nil
+}
@@ -0,0 +1,119 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// resign recomputes a tampered block's hash and signs it with privateKey
+func resign(t *testing.T, block *Block, privateKey []byte) {
+	t.Helper()
+	block.Hash = block.calculateHash()
+	if err := block.Sign(privateKey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSlotLeaderWeightedByPower(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	genesis := newTestGenesis(keys)
+	genesis.Validators[1].Stake = 3 * MinStakeAmount
+	state := genesis.State()
+
+	led := make(map[string]int)
+	for slot := uint64(1); slot <= 4000; slot++ {
+		leader, err := state.SlotLeader(slot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		led[leader]++
+	}
+
+	// Three quarters of the power should lead about 3000 slots
+	if n := led[keys[1].Address()]; n < 2700 || n > 3300 {
+		t.Fatalf("validator with 3/4 of the power led %d of 4000 slots", n)
+	}
+	if led[keys[0].Address()]+led[keys[1].Address()] != 4000 {
+		t.Fatal("expected every slot to be led by an active validator")
+	}
+}
+
+func TestBlockMustComeFromSlotLeader(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	bc := newTestChain(t, newTestGenesis(keys), NewMemoryBlockStore(), nil)
+	block := nextBlock(t, bc, keys, 0)
+	slot := bc.params.Slot(bc.Genesis.GenesisTime, block.Timestamp)
+	leader, other := keys[0], keys[1]
+	if block.Validator != leader.Address() {
+		leader, other = other, leader
+	}
+
+	impostor := bc.CreateBlock(other.Address(), slot, other.PrivateKey)
+	resign(t, impostor, other.PrivateKey)
+	if err := bc.AddBlock(impostor); err == nil {
+		t.Fatal("expected a block from a validator not leading its slot to be refused")
+	}
+
+	forged := *block
+	resign(t, &forged, other.PrivateKey)
+	if err := bc.AddBlock(&forged); err == nil {
+		t.Fatal("expected the leader's block signed by another key to be refused")
+	}
+
+	late := *block
+	late.Timestamp++
+	resign(t, &late, leader.PrivateKey)
+	if err := bc.AddBlock(&late); err == nil {
+		t.Fatal("expected a block not at the start of its slot to be refused")
+	}
+
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	stale := bc.CreateBlock(leader.Address(), slot, leader.PrivateKey)
+	resign(t, stale, leader.PrivateKey)
+	if err := bc.AddBlock(stale); err == nil {
+		t.Fatal("expected a block in its parent's slot to be refused")
+	}
+}
+
+func TestRandaoRevealMustMatchCommitment(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	genesis := newTestGenesis(keys)
+	bc := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+	if bc.HeadState().GetRandaoMix() != genesis.Hash() {
+		t.Fatal("expected the beacon to start from the genesis hash")
+	}
+
+	// Nothing has been committed to yet, so nothing may be revealed
+	uncommitted := nextBlock(t, bc, keys, 0)
+	uncommitted.RandaoReveal = strings.Repeat("00", randaoSecretSize)
+	resign(t, uncommitted, keys[0].PrivateKey)
+	if err := bc.AddBlock(uncommitted); err == nil {
+		t.Fatal("expected a reveal without a commitment to be refused")
+	}
+	first := mineBlock(t, bc, keys)
+	if first.RandaoReveal != "" || bc.HeadState().GetRandaoMix() != genesis.Hash() {
+		t.Fatal("expected a first block to commit without changing the beacon")
+	}
+
+	wrong := nextBlock(t, bc, keys, 0)
+	wrong.RandaoReveal = strings.Repeat("11", randaoSecretSize)
+	resign(t, wrong, keys[0].PrivateKey)
+	if err := bc.AddBlock(wrong); err == nil {
+		t.Fatal("expected a reveal not matching the commitment to be refused")
+	}
+
+	second := mineBlock(t, bc, keys)
+	secret := RandaoSecret(keys[0].PrivateKey, testChainID, first.Index)
+	if second.RandaoReveal != hex.EncodeToString(secret) || first.RandaoCommit != crypto.HashString(secret) {
+		t.Fatal("expected the second block to reveal the secret the first committed to")
+	}
+	mix, _ := hex.DecodeString(genesis.Hash())
+	if got, want := bc.HeadState().GetRandaoMix(), crypto.HashString(append(mix, secret...)); got != want {
+		t.Fatalf("beacon mix %s, want %s", got, want)
+	}
+}
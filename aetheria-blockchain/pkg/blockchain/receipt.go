@@ -0,0 +1,162 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// ReceiptStatus records whether a transaction executed
+type ReceiptStatus uint8
+
+const (
+	// StatusFailed means the transaction was included but failed to
+	// execute: only its fee was charged and its nonce consumed
+	StatusFailed ReceiptStatus = 0
+	// StatusSuccess means the transaction executed
+	StatusSuccess ReceiptStatus = 1
+)
+
+// String returns the name of the status
+func (s ReceiptStatus) String() string {
+	if s == StatusSuccess {
+		return "success"
+	}
+	return "failed"
+}
+
+// MarshalText encodes the status as its name (used by JSON)
+func (s ReceiptStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// EventType identifies what an event records
+type EventType uint8
+
+const (
+	// EventTransfer moves Amount of Asset from From to To
+	EventTransfer EventType = iota
+	// EventStake bonds Amount of From's balance as stake
+	EventStake
+	// EventUnstake moves Amount of From's stake into unbonding
+	EventUnstake
+	// EventDelegate bonds Amount of From's balance to validator To
+	EventDelegate
+	// EventUndelegate moves Amount of From's delegation to To into unbonding
+	EventUndelegate
+	// EventCommission sets From's commission to Amount basis points
+	EventCommission
+	// EventReward pays To a block reward, its fees, or a delegator's share
+	// of them from validator From
+	EventReward
+	// EventMint creates Amount of Asset for To
+	EventMint
+	// EventBurn destroys Amount of Asset held by From (fees when From is empty)
+	EventBurn
+	// EventLock locks Amount of Asset from From in an HTLC for To
+	EventLock
+	// EventUnlock releases an HTLC locked by From to To: the recipient on a
+	// claim, the sender on a refund
+	EventUnlock
+)
+
+// eventTypeNames maps event types to their names
+var eventTypeNames = map[EventType]string{
+	EventTransfer:   "transfer",
+	EventStake:      "stake",
+	EventUnstake:    "unstake",
+	EventDelegate:   "delegate",
+	EventUndelegate: "undelegate",
+	EventCommission: "commission",
+	EventReward:     "reward",
+	EventMint:       "mint",
+	EventBurn:       "burn",
+	EventLock:       "lock",
+	EventUnlock:     "unlock",
+}
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(t))
+}
+
+// MarshalText encodes the type as its name (used by JSON)
+func (t EventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Event records one effect of a transaction on the state
+type Event struct {
+	Type   EventType `json:"type"`
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to,omitempty"`
+	Asset  string    `json:"asset,omitempty"` // issued asset symbol, empty for the native token
+	Amount uint64    `json:"amount"`
+}
+
+// Receipt records the outcome of a transaction included in a block. The
+// coinbase's receipt also carries the block's rewards and fee burn.
+type Receipt struct {
+	TxID        string        `json:"tx_id"`
+	Status      ReceiptStatus `json:"status"`
+	Error       string        `json:"error,omitempty"` // why execution failed; not committed
+	FeePaid     uint64        `json:"fee_paid"`
+	BlockHeight uint64        `json:"block_height"`
+	Position    int           `json:"position"` // index of the transaction in its block
+	Events      []Event       `json:"events"`
+}
+
+// ReceiptsRoot computes the Merkle root committing to a block's receipts,
+// in transaction order
+func ReceiptsRoot(receipts []*Receipt) string {
+	leaves := make([][]byte, len(receipts))
+	for i, receipt := range receipts {
+		leaves[i] = crypto.Hash(receipt.Encode())
+	}
+	return hex.EncodeToString(crypto.MerkleRoot(leaves))
+}
+
+// txEvents returns the events a transaction produces if it executes, read
+// from the state before it is applied; callers must hold s.mu
+func (s *State) txEvents(tx *Transaction) []Event {
+	switch tx.Type {
+	case TxTransfer:
+		return []Event{{Type: EventTransfer, From: tx.From, To: tx.To, Amount: tx.Amount}}
+	case TxStake:
+		return []Event{{Type: EventStake, From: tx.From, Amount: tx.Amount}}
+	case TxUnstake:
+		return []Event{{Type: EventUnstake, From: tx.From, Amount: tx.Amount}}
+	case TxDelegate:
+		return []Event{{Type: EventDelegate, From: tx.From, To: tx.To, Amount: tx.Amount}}
+	case TxUndelegate:
+		return []Event{{Type: EventUndelegate, From: tx.From, To: tx.To, Amount: tx.Amount}}
+	case TxSetCommission:
+		return []Event{{Type: EventCommission, From: tx.From, Amount: tx.Amount}}
+	case TxIssueAsset:
+		if tx.Amount == 0 {
+			return []Event{}
+		}
+		return []Event{{Type: EventMint, To: tx.From, Asset: tx.Asset, Amount: tx.Amount}}
+	case TxMintAsset:
+		recipient := tx.To
+		if recipient == "" {
+			recipient = tx.From
+		}
+		return []Event{{Type: EventMint, To: recipient, Asset: tx.Asset, Amount: tx.Amount}}
+	case TxBurnAsset:
+		return []Event{{Type: EventBurn, From: tx.From, Asset: tx.Asset, Amount: tx.Amount}}
+	case TxTransferAsset:
+		return []Event{{Type: EventTransfer, From: tx.From, To: tx.To, Asset: tx.Asset, Amount: tx.Amount}}
+	case TxLockHTLC:
+		return []Event{{Type: EventLock, From: tx.From, To: tx.To, Asset: tx.Asset, Amount: tx.Amount}}
+	case TxClaimHTLC, TxRefundHTLC:
+		htlc := s.HTLCs[tx.ContractID]
+		return []Event{{Type: EventUnlock, From: htlc.Sender, To: tx.From, Asset: htlc.Asset, Amount: htlc.Amount}}
+	default:
+		return []Event{}
+	}
+}
@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/aetheria/blockchain/pkg/monetary"
+)
+
+// RewardSchedule decides how much a block's coinbase mints. The reward may
+// depend on the block's height and the supply before the block but not on
+// its transactions, which are chosen after the coinbase is created.
+// monetary.Policy is a RewardSchedule.
+type RewardSchedule interface {
+	CalculateReward(height uint64, supply monetary.Supply) uint64
+}
+
+// SetRewardSchedule sets the schedule coinbase amounts are checked against
+// (nil means the monetary policy in the state's parameters)
+func (s *State) SetRewardSchedule(rewards RewardSchedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rewards = rewards
+}
+
+// rewardSchedule returns the schedule in use; callers must hold s.mu
+func (s *State) rewardSchedule() RewardSchedule {
+	if s.rewards == nil {
+		return s.params.Monetary
+	}
+	return s.rewards
+}
+
+// GetSupply returns the coins minted, burned, bonded, unbonding and locked
+// so far
+func (s *State) GetSupply() monetary.Supply {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.supply()
+}
+
+// supply returns the supply; callers must hold s.mu
+func (s *State) supply() monetary.Supply {
+	supply := monetary.Supply{Minted: s.TotalMinted, Burned: s.TotalBurned}
+	for _, stake := range s.Stakes {
+		supply.Bonded += stake
+	}
+	for _, delegations := range s.Delegations {
+		for _, amount := range delegations {
+			supply.Bonded += amount
+		}
+	}
+	for _, entries := range s.Unbonding {
+		for _, entry := range entries {
+			supply.Unbonding += entry.Amount
+		}
+	}
+	for _, htlc := range s.HTLCs {
+		if htlc.Asset == "" {
+			supply.Locked += htlc.Amount
+		}
+	}
+	return supply
+}
+
+// checkCoinbase enforces the coinbase rules: the first transaction, and
+// only that one, is a coinbase, and it pays the scheduled reward to the
+// block's validator
+func (s *State) checkCoinbase(block *Block) error {
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return fmt.Errorf("block must start with a coinbase transaction")
+	}
+	for i, tx := range block.Transactions[1:] {
+		if tx.IsCoinbase() {
+			return fmt.Errorf("transaction %d has no sender; only the first transaction may be a coinbase", i+1)
+		}
+	}
+
+	coinbase := block.Transactions[0]
+	if coinbase.To != block.Validator {
+		return fmt.Errorf("coinbase pays %s, not the block validator %s", coinbase.To, block.Validator)
+	}
+
+	s.mu.RLock()
+	reward := s.rewardSchedule().CalculateReward(block.Index, s.supply())
+	s.mu.RUnlock()
+	if coinbase.Amount != reward {
+		return fmt.Errorf("coinbase mints %d, scheduled reward is %d", coinbase.Amount, reward)
+	}
+	return nil
+}
+
+// burnFees burns the policy's share of a block's fees and returns what is
+// left for the validator
+func (s *State) burnFees(fees uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	burned := s.params.Monetary.BurnedFees(fees)
+	s.TotalBurned += burned
+	return fees - burned
+}
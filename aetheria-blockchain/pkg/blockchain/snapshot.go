@@ -0,0 +1,201 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".json"
+)
+
+// Snapshot is a copy of State taken right after the block at Height was applied
+type Snapshot struct {
+	Height    uint64 `json:"height"`
+	BlockHash string `json:"block_hash"`
+	State     *State `json:"state"`
+	Checksum  string `json:"checksum"`
+}
+
+// NewSnapshot creates a checksummed snapshot of state at the given block
+func NewSnapshot(height uint64, blockHash string, state *State) (*Snapshot, error) {
+	snap := &Snapshot{
+		Height:    height,
+		BlockHash: blockHash,
+		State:     state.Clone(),
+	}
+	checksum, err := snap.calculateChecksum()
+	if err != nil {
+		return nil, err
+	}
+	snap.Checksum = checksum
+	return snap, nil
+}
+
+// calculateChecksum hashes the height, block hash and encoded state
+func (snap *Snapshot) calculateChecksum() (string, error) {
+	stateData, err := json.Marshal(snap.State)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snapshot state: %w", err)
+	}
+
+	data := make([]byte, 8, 8+len(snap.BlockHash)+len(stateData))
+	binary.BigEndian.PutUint64(data, snap.Height)
+	data = append(data, snap.BlockHash...)
+	data = append(data, stateData...)
+	return crypto.HashString(data), nil
+}
+
+// Verify checks the snapshot's checksum
+func (snap *Snapshot) Verify() error {
+	if snap.State == nil {
+		return fmt.Errorf("snapshot has no state")
+	}
+	expected, err := snap.calculateChecksum()
+	if err != nil {
+		return err
+	}
+	if snap.Checksum != expected {
+		return fmt.Errorf("snapshot checksum mismatch at height %d", snap.Height)
+	}
+	return nil
+}
+
+// SnapshotStore manages snapshot files in a directory
+type SnapshotStore struct {
+	Dir      string
+	Interval uint64 // snapshot the final block every Interval heights (0 disables)
+	Keep     int    // number of snapshots to retain (0 keeps all)
+}
+
+// NewSnapshotStore creates a snapshot store rooted at dir
+func NewSnapshotStore(dir string, interval uint64, keep int) (*SnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	return &SnapshotStore{
+		Dir:      dir,
+		Interval: interval,
+		Keep:     keep,
+	}, nil
+}
+
+// ShouldSnapshot reports whether a snapshot is due once finality moves from
+// height from to height to, passing a multiple of Interval
+func (ss *SnapshotStore) ShouldSnapshot(from, to uint64) bool {
+	return ss.Interval > 0 && to/ss.Interval > from/ss.Interval
+}
+
+// path returns the file name for a snapshot height
+func (ss *SnapshotStore) path(height uint64) string {
+	return filepath.Join(ss.Dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, height, snapshotSuffix))
+}
+
+// Save writes a snapshot atomically (temp file, fsync, rename) and prunes
+// old snapshots beyond Keep
+func (ss *SnapshotStore) Save(snap *Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(ss.Dir, snapshotPrefix+"*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	if err := os.Rename(tmpName, ss.path(snap.Height)); err != nil {
+		return fmt.Errorf("failed to commit snapshot: %w", err)
+	}
+
+	// Make the rename itself durable
+	if dir, err := os.Open(ss.Dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return ss.prune()
+}
+
+// List returns the heights of all snapshots on disk, oldest first
+func (ss *SnapshotStore) List() ([]uint64, error) {
+	entries, err := os.ReadDir(ss.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	heights := make([]uint64, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		var height uint64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix), "%d", &height); err != nil {
+			continue
+		}
+		heights = append(heights, height)
+	}
+
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights, nil
+}
+
+// Load reads the snapshot at height and verifies its checksum
+func (ss *SnapshotStore) Load(height uint64) (*Snapshot, error) {
+	data, err := os.ReadFile(ss.path(height))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if snap.Height != height {
+		return nil, fmt.Errorf("snapshot file for height %d contains height %d", height, snap.Height)
+	}
+	if err := snap.Verify(); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// prune removes the oldest snapshots beyond Keep
+func (ss *SnapshotStore) prune() error {
+	if ss.Keep <= 0 {
+		return nil
+	}
+	heights, err := ss.List()
+	if err != nil {
+		return err
+	}
+	for len(heights) > ss.Keep {
+		if err := os.Remove(ss.path(heights[0])); err != nil {
+			return fmt.Errorf("failed to prune snapshot: %w", err)
+		}
+		heights = heights[1:]
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestShouldSnapshot(t *testing.T) {
+	ss := &SnapshotStore{Interval: 10}
+	cases := []struct {
+		from, to uint64
+		due      bool
+	}{
+		{0, 9, false},
+		{0, 10, true},
+		{9, 12, true},
+		{10, 19, false},
+		{18, 31, true},
+	}
+	for _, c := range cases {
+		if got := ss.ShouldSnapshot(c.from, c.to); got != c.due {
+			t.Errorf("ShouldSnapshot(%d, %d) = %v, want %v", c.from, c.to, got, c.due)
+		}
+	}
+	if (&SnapshotStore{}).ShouldSnapshot(0, 100) {
+		t.Error("expected no snapshots with a zero interval")
+	}
+}
+
+// openTestStores opens the block and snapshot stores kept in dir
+func openTestStores(t *testing.T, dir string) (*FileBlockStore, *SnapshotStore) {
+	t.Helper()
+	store, err := OpenFileBlockStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := NewSnapshotStore(filepath.Join(dir, "snapshots"), 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, snapshots
+}
+
+func TestSnapshotsOnlyFinalBlocks(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	genesis := newTestGenesis(keys)
+	store, snapshots := openTestStores(t, t.TempDir())
+	bc := newTestChain(t, genesis, store, snapshots)
+
+	for i := 0; i < 3; i++ {
+		mineBlock(t, bc, keys)
+	}
+	if heights, _ := snapshots.List(); len(heights) != 0 {
+		t.Fatalf("expected no snapshots of blocks that are not final, got %v", heights)
+	}
+	if _, err := bc.CreateSnapshot(); err == nil {
+		t.Fatal("expected no snapshot before any block is final")
+	}
+
+	commitBlock(t, bc, bc.GetBlock(3), keys)
+	heights, err := snapshots.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 1 || heights[0] != 3 {
+		t.Fatalf("expected a snapshot of final block 3, got %v", heights)
+	}
+
+	mineBlock(t, bc, keys)
+	snap, err := bc.CreateSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Height != 3 || snap.BlockHash != bc.GetBlock(3).Hash {
+		t.Fatalf("expected a snapshot of final block 3, got block %d", snap.Height)
+	}
+	if err := bc.VerifySnapshot(snap); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestartAfterReorgPastSnapshot(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	genesis := newTestGenesis(keys)
+	dir := t.TempDir()
+	store, snapshots := openTestStores(t, dir)
+	bc := newTestChain(t, genesis, store, snapshots)
+
+	// A snapshot of a head that is later orphaned, as an older node wrote
+	mineBlock(t, bc, keys)
+	orphan := mineBlock(t, bc, keys)
+	stale, err := NewSnapshot(orphan.Index, orphan.Hash, bc.HeadState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshots.Save(stale); err != nil {
+		t.Fatal(err)
+	}
+
+	// A longer branch from genesis replaces it
+	other := newTestChain(t, genesis, NewMemoryBlockStore(), nil)
+	var branch []*Block
+	for i := 0; i < 3; i++ {
+		block := nextBlock(t, other, keys, 1)
+		if err := other.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		branch = append(branch, block)
+	}
+	for _, block := range branch {
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	head := branch[len(branch)-1]
+	if bc.GetLatestBlock().Hash != head.Hash {
+		t.Fatal("expected the longer branch to become canonical")
+	}
+	store.Close()
+
+	// The stale snapshot is not final, so the chain reopens from genesis
+	store, snapshots = openTestStores(t, dir)
+	bc = newTestChain(t, genesis, store, snapshots)
+	if bc.GetLatestBlock().Hash != head.Hash {
+		t.Fatalf("expected head %s after restart, got %s", head.Hash, bc.GetLatestBlock().Hash)
+	}
+
+	// Once a block of the new branch is final, restarts start from it
+	commitBlock(t, bc, branch[1], keys)
+	mineBlock(t, bc, keys)
+	head = bc.GetLatestBlock()
+	store.Close()
+
+	store, snapshots = openTestStores(t, dir)
+	defer store.Close()
+	bc = newTestChain(t, genesis, store, snapshots)
+	if bc.root.block.Hash != branch[1].Hash {
+		t.Fatalf("expected the chain to reopen from the snapshot of block %d, got root %d", branch[1].Index, bc.root.block.Index)
+	}
+	if bc.GetLatestBlock().Hash != head.Hash || bc.FinalizedHeight() != branch[1].Index {
+		t.Fatalf("expected head %d with block %d final after restart", head.Index, branch[1].Index)
+	}
+}
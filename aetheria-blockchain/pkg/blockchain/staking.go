@@ -0,0 +1,187 @@
+package blockchain
+
+import "fmt"
+
+// GetValidatorKey returns the hex public key registered by a staker
+func (s *State) GetValidatorKey(address string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ValidatorKeys[address]
+}
+
+// SetValidatorKey registers the public key that signs an address's blocks
+func (s *State) SetValidatorKey(address, publicKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ValidatorKeys[address] = publicKey
+	s.touch(address)
+}
+
+// applyStake bonds stake from the sender's balance and records the key the
+// sender signs blocks with; callers must hold s.mu
+func (s *State) applyStake(tx *Transaction) error {
+	if tx.Amount == 0 {
+		return fmt.Errorf("stake amount must be positive")
+	}
+	if s.Tombstoned[tx.From] {
+		return fmt.Errorf("validator %s is tombstoned", tx.From)
+	}
+	if stake := s.Stakes[tx.From] + tx.Amount; stake < s.params.MinValidatorStake {
+		return fmt.Errorf("stake of %d is below the minimum validator stake of %d", stake, s.params.MinValidatorStake)
+	}
+	s.Balances[tx.From] -= tx.Amount + tx.Fee
+	s.Stakes[tx.From] += tx.Amount
+	if s.ValidatorKeys[tx.From] != tx.PublicKey {
+		// Secrets are derived from the key, so a new key starts afresh
+		delete(s.RandaoCommits, tx.From)
+	}
+	s.ValidatorKeys[tx.From] = tx.PublicKey
+	return nil
+}
+
+// applyUnstake moves stake into the sender's unbonding queue; callers must
+// hold s.mu
+func (s *State) applyUnstake(tx *Transaction) error {
+	if tx.Amount == 0 {
+		return fmt.Errorf("unstake amount must be positive")
+	}
+	if s.Stakes[tx.From] < tx.Amount {
+		return fmt.Errorf("insufficient stake: has %d, needs %d", s.Stakes[tx.From], tx.Amount)
+	}
+	s.Balances[tx.From] -= tx.Fee
+	s.Stakes[tx.From] -= tx.Amount
+	s.addUnbonding(tx.From, tx.From, tx.Amount)
+	return nil
+}
+
+// UnbondingEntry is stake waiting out the unbonding period. It no longer
+// counts toward the validator's power but can still be slashed for the
+// validator's misbehaviour until released.
+type UnbondingEntry struct {
+	Validator        string `json:"validator"` // validator the funds were bonded to
+	Amount           uint64 `json:"amount"`
+	CompletionHeight uint64 `json:"completion_height"` // first block in which the funds are spendable
+}
+
+// GetUnbonding returns an address's pending unbonding entries, oldest first
+func (s *State) GetUnbonding(address string) []UnbondingEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]UnbondingEntry, len(s.Unbonding[address]))
+	copy(entries, s.Unbonding[address])
+	return entries
+}
+
+// TotalUnbonding returns the sum of an address's pending unbonding entries
+func (s *State) TotalUnbonding(address string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total uint64
+	for _, entry := range s.Unbonding[address] {
+		total += entry.Amount
+	}
+	return total
+}
+
+// addUnbonding queues funds unbonded from validator for release to address;
+// callers must hold s.mu
+func (s *State) addUnbonding(address, validator string, amount uint64) {
+	s.Unbonding[address] = append(s.Unbonding[address], UnbondingEntry{
+		Validator:        validator,
+		Amount:           amount,
+		CompletionHeight: s.Height + s.params.UnbondingPeriod,
+	})
+	s.touch(address)
+}
+
+// beginBlock advances the state to the block at height, releases every
+// unbonding entry that has completed into its owner's balance and, at an
+// epoch start, elects the epoch's validators
+func (s *State) beginBlock(height uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Height = height
+	for addr, entries := range s.Unbonding {
+		pending := entries[:0]
+		for _, entry := range entries {
+			if entry.CompletionHeight <= height {
+				s.Balances[addr] += entry.Amount
+				continue
+			}
+			pending = append(pending, entry)
+		}
+		if len(pending) == len(entries) {
+			continue
+		}
+		s.touch(addr)
+		if len(pending) == 0 {
+			delete(s.Unbonding, addr)
+		} else {
+			s.Unbonding[addr] = pending
+		}
+	}
+
+	// The election sees the staking state the previous epoch left, before
+	// the block's own transactions
+	if s.params.IsEpochStart(height) {
+		s.electValidators()
+	}
+}
+
+// Slash burns basisPoints/BasisPoints of everything bonded to a validator:
+// its own stake, the stake delegated to it, and unbonding entries from it
+// that have not been released yet, so unbonding does not escape a penalty.
+// It returns the total amount burned.
+func (s *State) Slash(validator string, basisPoints uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.slash(validator, basisPoints)
+}
+
+// slash implements Slash; callers must hold s.mu
+func (s *State) slash(validator string, basisPoints uint64) uint64 {
+	if basisPoints > BasisPoints {
+		basisPoints = BasisPoints
+	}
+
+	slashed := mulDiv(s.Stakes[validator], basisPoints, BasisPoints)
+	s.Stakes[validator] -= slashed
+	s.touch(validator)
+
+	for delegator, delegations := range s.Delegations {
+		amount := delegations[validator]
+		if amount == 0 {
+			continue
+		}
+		cut := mulDiv(amount, basisPoints, BasisPoints)
+		slashed += cut
+		if cut > 0 {
+			s.removeDelegation(delegator, validator, cut)
+		}
+	}
+
+	for addr, entries := range s.Unbonding {
+		pending := entries[:0]
+		for _, entry := range entries {
+			if entry.Validator == validator {
+				cut := mulDiv(entry.Amount, basisPoints, BasisPoints)
+				slashed += cut
+				entry.Amount -= cut
+				s.touch(addr)
+			}
+			if entry.Amount > 0 {
+				pending = append(pending, entry)
+			}
+		}
+		if len(pending) == 0 {
+			delete(s.Unbonding, addr)
+		} else {
+			s.Unbonding[addr] = pending
+		}
+	}
+
+	s.TotalBurned += slashed
+	return slashed
+}
@@ -1,25 +1,71 @@
 package blockchain
 
 import (
+	"encoding/hex"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+
+	"github.com/aetheria/blockchain/pkg/codec"
+	"github.com/aetheria/blockchain/pkg/crypto"
 )
 
 // State represents the global state of the blockchain
 type State struct {
-	Balances map[string]uint64 `json:"balances"` // address -> balance
-	Stakes   map[string]uint64 `json:"stakes"`   // address -> staked amount
-	mu       sync.RWMutex
+	Height        uint64                       `json:"height"`         // index of the last applied block
+	Balances      map[string]uint64            `json:"balances"`       // address -> balance
+	Stakes        map[string]uint64            `json:"stakes"`         // address -> staked amount
+	Nonces        map[string]uint64            `json:"nonces"`         // address -> next expected nonce
+	ValidatorKeys map[string]string            `json:"validator_keys"` // staker address -> hex public key
+	Unbonding     map[string][]UnbondingEntry  `json:"unbonding"`      // address -> pending withdrawals, oldest first
+	Delegations   map[string]map[string]uint64 `json:"delegations"`    // delegator -> validator -> amount
+	Commissions   map[string]uint64            `json:"commissions"`    // validator -> commission in basis points
+	Tombstoned    map[string]bool              `json:"tombstoned"`     // validators slashed for double-signing
+	Assets        map[string]Asset             `json:"assets"`         // symbol -> issued asset
+	AssetBalances map[string]map[string]uint64 `json:"asset_balances"` // address -> symbol -> balance
+	HTLCs         map[string]HTLC              `json:"htlcs"`          // contract ID -> open contract
+	HashLocks     map[string][]string          `json:"hash_locks"`     // hash lock -> IDs of the open contracts locked to it, sorted
+	Validators    []ActiveValidator            `json:"validators"`     // validator set elected at the epoch start
+	RandaoMix     string                       `json:"randao_mix"`     // beacon output seeding leader election
+	RandaoCommits map[string]RandaoCommitment  `json:"randao_commits"` // validator -> secret to reveal in its next block
+	TotalMinted   uint64                       `json:"total_minted"`   // coins created at genesis and by coinbases
+	TotalBurned   uint64                       `json:"total_burned"`   // coins destroyed by fee burning and slashing
+	params        Params
+	rewards       RewardSchedule
+	tree          *crypto.SparseMerkleTree // state tree as of the last root; nil until first built
+	dirty         map[string]bool          // tree keys changed since the tree was last updated
+	mu            sync.RWMutex
 }
 
-// NewState creates a new state
+// NewState creates a new state with the default parameters, whose monetary
+// policy decides the block reward
 func NewState() *State {
 	return &State{
-		Balances: make(map[string]uint64),
-		Stakes:   make(map[string]uint64),
+		Balances:      make(map[string]uint64),
+		Stakes:        make(map[string]uint64),
+		Nonces:        make(map[string]uint64),
+		ValidatorKeys: make(map[string]string),
+		Unbonding:     make(map[string][]UnbondingEntry),
+		Delegations:   make(map[string]map[string]uint64),
+		Commissions:   make(map[string]uint64),
+		Tombstoned:    make(map[string]bool),
+		Assets:        make(map[string]Asset),
+		AssetBalances: make(map[string]map[string]uint64),
+		HTLCs:         make(map[string]HTLC),
+		HashLocks:     make(map[string][]string),
+		RandaoCommits: make(map[string]RandaoCommitment),
+		params:        DefaultParams(),
 	}
 }
 
+// SetParams sets the consensus parameters used when applying blocks
+func (s *State) SetParams(params Params) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.params = params
+}
+
 // GetBalance returns the balance of an address
 func (s *State) GetBalance(address string) uint64 {
 	s.mu.RLock()
@@ -34,11 +80,19 @@ func (s *State) GetStake(address string) uint64 {
 	return s.Stakes[address]
 }
 
+// GetNonce returns the nonce the next transaction from address must carry
+func (s *State) GetNonce(address string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Nonces[address]
+}
+
 // SetBalance sets the balance of an address
 func (s *State) SetBalance(address string, amount uint64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.Balances[address] = amount
+	s.touch(address)
 }
 
 // AddBalance adds to the balance of an address
@@ -46,17 +100,28 @@ func (s *State) AddBalance(address string, amount uint64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.Balances[address] += amount
+	s.touch(address)
+}
+
+// mint creates coins in the balance of an address
+func (s *State) mint(address string, amount uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Balances[address] += amount
+	s.TotalMinted += amount
+	s.touch(address)
 }
 
 // SubBalance subtracts from the balance of an address
 func (s *State) SubBalance(address string, amount uint64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	
+
 	if s.Balances[address] < amount {
 		return fmt.Errorf("insufficient balance")
 	}
 	s.Balances[address] -= amount
+	s.touch(address)
 	return nil
 }
 
@@ -64,69 +129,193 @@ func (s *State) SubBalance(address string, amount uint64) error {
 func (s *State) AddStake(address string, amount uint64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	
+
 	if s.Balances[address] < amount {
 		return fmt.Errorf("insufficient balance to stake")
 	}
-	
+
 	s.Balances[address] -= amount
 	s.Stakes[address] += amount
+	s.touch(address)
 	return nil
 }
 
-// RemoveStake removes from the staked amount of an address
+// RemoveStake unbonds part of an address's stake. The amount becomes
+// spendable once the unbonding period has passed.
 func (s *State) RemoveStake(address string, amount uint64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	
+
 	if s.Stakes[address] < amount {
 		return fmt.Errorf("insufficient stake")
 	}
-	
+
 	s.Stakes[address] -= amount
-	s.Balances[address] += amount
+	s.addUnbonding(address, address, amount)
+	s.touch(address)
 	return nil
 }
 
-// ApplyTransaction applies a transaction to the state
-func (s *State) ApplyTransaction(tx *Transaction) error {
+// ApplyTransaction applies a transaction to the state and returns its
+// receipt. An error means the transaction is invalid and cannot be included
+// in a block. A valid transaction that fails to execute is still applied:
+// its fee is charged, its nonce consumed, and its receipt has StatusFailed.
+func (s *State) ApplyTransaction(tx *Transaction) (*Receipt, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Coinbase transaction (mining reward)
+	// Coinbases mint coins and are only applied as part of their block
 	if tx.IsCoinbase() {
-		s.Balances[tx.To] += tx.Amount
-		return nil
+		return nil, fmt.Errorf("coinbase transaction outside a block")
+	}
+
+	if _, ok := txTypeNames[tx.Type]; !ok {
+		return nil, fmt.Errorf("unknown transaction type %d", tx.Type)
+	}
+	if err := tx.checkFields(); err != nil {
+		return nil, err
+	}
+	if err := tx.checkCost(); err != nil {
+		return nil, err
+	}
+
+	// Check nonce
+	if tx.Nonce != s.Nonces[tx.From] {
+		return nil, fmt.Errorf("invalid nonce: expected %d, got %d", s.Nonces[tx.From], tx.Nonce)
 	}
 
 	// Check balance
-	totalRequired := tx.Amount + tx.Fee
+	totalRequired := tx.Cost()
 	if s.Balances[tx.From] < totalRequired {
-		return fmt.Errorf("insufficient balance: has %d, needs %d", s.Balances[tx.From], totalRequired)
+		return nil, fmt.Errorf("insufficient balance: has %d, needs %d", s.Balances[tx.From], totalRequired)
 	}
 
-	// Apply transaction
-	s.Balances[tx.From] -= totalRequired
-	s.Balances[tx.To] += tx.Amount
+	receipt := &Receipt{
+		TxID:        tx.ID,
+		Status:      StatusSuccess,
+		FeePaid:     tx.Fee,
+		BlockHeight: s.Height,
+		Events:      s.txEvents(tx),
+	}
+	if err := s.execute(tx); err != nil {
+		s.Balances[tx.From] -= tx.Fee
+		receipt.Status = StatusFailed
+		receipt.Error = err.Error()
+		receipt.Events = []Event{}
+	}
+	s.Nonces[tx.From]++
+	// The sender's own changes are covered here; execute marks the other
+	// keys a transaction changes
+	s.touch(tx.From)
 
-	return nil
+	return receipt, nil
 }
 
-// ApplyBlock applies all transactions in a block to the state
-func (s *State) ApplyBlock(block *Block) error {
-	for _, tx := range block.Transactions {
-		if err := s.ApplyTransaction(tx); err != nil {
-			return fmt.Errorf("failed to apply transaction %s: %w", tx.ID, err)
+// execute applies a valid transaction's effects, leaving the state
+// untouched when it fails; callers must hold s.mu
+func (s *State) execute(tx *Transaction) error {
+	switch tx.Type {
+	case TxTransfer:
+		s.Balances[tx.From] -= tx.Cost()
+		s.Balances[tx.To] += tx.Amount
+		s.touch(tx.To)
+		return nil
+	case TxStake:
+		return s.applyStake(tx)
+	case TxUnstake:
+		return s.applyUnstake(tx)
+	case TxDelegate:
+		return s.applyDelegate(tx)
+	case TxUndelegate:
+		return s.applyUndelegate(tx)
+	case TxSetCommission:
+		return s.applySetCommission(tx)
+	case TxIssueAsset:
+		return s.applyIssueAsset(tx)
+	case TxMintAsset:
+		return s.applyMintAsset(tx)
+	case TxBurnAsset:
+		return s.applyBurnAsset(tx)
+	case TxTransferAsset:
+		return s.applyTransferAsset(tx)
+	case TxLockHTLC:
+		return s.applyLockHTLC(tx)
+	case TxClaimHTLC:
+		return s.applyClaimHTLC(tx)
+	case TxRefundHTLC:
+		return s.applyRefundHTLC(tx)
+	default:
+		return fmt.Errorf("unknown transaction type %d", tx.Type)
+	}
+}
+
+// ApplyBlock applies a block's evidence and transactions to the state and
+// returns a receipt per transaction, in block order. The block must follow
+// the coinbase rules of checkCoinbase.
+func (s *State) ApplyBlock(block *Block) ([]*Receipt, error) {
+	if err := s.checkCoinbase(block); err != nil {
+		return nil, err
+	}
+
+	s.beginBlock(block.Index)
+	if err := s.applyRandao(block); err != nil {
+		return nil, err
+	}
+
+	for _, ev := range block.Evidence {
+		if _, err := s.ApplyEvidence(ev, block.Validator); err != nil {
+			return nil, fmt.Errorf("failed to apply evidence %s: %w", ev.ID(), err)
+		}
+	}
+
+	receipts := make([]*Receipt, 0, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			s.mint(tx.To, tx.Amount)
+			receipts = append(receipts, &Receipt{
+				TxID:        tx.ID,
+				Status:      StatusSuccess,
+				BlockHeight: block.Index,
+				Position:    i,
+				Events:      []Event{{Type: EventReward, To: tx.To, Amount: tx.Amount}},
+			})
+			continue
 		}
+		receipt, err := s.ApplyTransaction(tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply transaction %s: %w", tx.ID, err)
+		}
+		receipt.Position = i
+		receipts = append(receipts, receipt)
 	}
-	
-	// Add fees to validator
-	fees := block.TotalFees()
+
+	// Burn the policy's share of the fees and pay the rest to the validator
+	totalFees := block.TotalFees()
+	fees := s.burnFees(totalFees)
 	if fees > 0 {
 		s.AddBalance(block.Validator, fees)
 	}
-	
-	return nil
+
+	// Share the block reward and fees with the validator's delegators
+	rewards := fees
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() && tx.To == block.Validator {
+			rewards += tx.Amount
+		}
+	}
+	shares := s.payDelegators(block.Validator, rewards)
+
+	// The coinbase receipt records where the block's fees went
+	coinbase := receipts[0]
+	if fees > 0 {
+		coinbase.Events = append(coinbase.Events, Event{Type: EventReward, To: block.Validator, Amount: fees})
+	}
+	if burned := totalFees - fees; burned > 0 {
+		coinbase.Events = append(coinbase.Events, Event{Type: EventBurn, Amount: burned})
+	}
+	coinbase.Events = append(coinbase.Events, shares...)
+
+	return receipts, nil
 }
 
 // Clone creates a copy of the state
@@ -135,12 +324,66 @@ func (s *State) Clone() *State {
 	defer s.mu.RUnlock()
 
 	newState := NewState()
+	newState.Height = s.Height
+	newState.params = s.params
+	newState.rewards = s.rewards
+	newState.TotalMinted = s.TotalMinted
+	newState.TotalBurned = s.TotalBurned
 	for addr, balance := range s.Balances {
 		newState.Balances[addr] = balance
 	}
 	for addr, stake := range s.Stakes {
 		newState.Stakes[addr] = stake
 	}
+	for addr, nonce := range s.Nonces {
+		newState.Nonces[addr] = nonce
+	}
+	for addr, key := range s.ValidatorKeys {
+		newState.ValidatorKeys[addr] = key
+	}
+	for addr, entries := range s.Unbonding {
+		newState.Unbonding[addr] = append([]UnbondingEntry(nil), entries...)
+	}
+	for delegator, delegations := range s.Delegations {
+		copied := make(map[string]uint64, len(delegations))
+		for validator, amount := range delegations {
+			copied[validator] = amount
+		}
+		newState.Delegations[delegator] = copied
+	}
+	for addr, rate := range s.Commissions {
+		newState.Commissions[addr] = rate
+	}
+	for addr := range s.Tombstoned {
+		newState.Tombstoned[addr] = true
+	}
+	for symbol, asset := range s.Assets {
+		newState.Assets[symbol] = asset
+	}
+	for addr, balances := range s.AssetBalances {
+		copied := make(map[string]uint64, len(balances))
+		for symbol, amount := range balances {
+			copied[symbol] = amount
+		}
+		newState.AssetBalances[addr] = copied
+	}
+	for id, htlc := range s.HTLCs {
+		newState.HTLCs[id] = htlc
+	}
+	for hashLock, ids := range s.HashLocks {
+		newState.HashLocks[hashLock] = append([]string(nil), ids...)
+	}
+	newState.Validators = append([]ActiveValidator(nil), s.Validators...)
+	newState.RandaoMix = s.RandaoMix
+	for addr, commitment := range s.RandaoCommits {
+		newState.RandaoCommits[addr] = commitment
+	}
+	if s.tree != nil {
+		newState.tree = s.tree.Copy()
+		for key := range s.dirty {
+			newState.touch(key)
+		}
+	}
 	return newState
 }
 
@@ -148,7 +391,7 @@ func (s *State) Clone() *State {
 func (s *State) TotalStaked() uint64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	
+
 	var total uint64
 	for _, stake := range s.Stakes {
 		total += stake
@@ -156,16 +399,193 @@ func (s *State) TotalStaked() uint64 {
 	return total
 }
 
-// GetValidators returns all addresses with stake
+// GetValidators returns all addresses with stake that have not been
+// tombstoned, sorted
 func (s *State) GetValidators() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	
+
 	validators := make([]string, 0, len(s.Stakes))
 	for addr, stake := range s.Stakes {
-		if stake > 0 {
+		if stake > 0 && !s.Tombstoned[addr] {
 			validators = append(validators, addr)
 		}
 	}
+	sort.Strings(validators)
 	return validators
 }
+
+// Account is the committed view of a single address in the state root
+type Account struct {
+	Balance      uint64           `json:"balance"`
+	Stake        uint64           `json:"stake"`
+	Nonce        uint64           `json:"nonce"`
+	ValidatorKey string           `json:"validator_key,omitempty"`
+	Commission   uint64           `json:"commission,omitempty"`
+	Tombstoned   bool             `json:"tombstoned,omitempty"`
+	Delegations  []Delegation     `json:"delegations,omitempty"`
+	Unbonding    []UnbondingEntry `json:"unbonding,omitempty"`
+	Assets       []AssetBalance   `json:"assets,omitempty"`
+}
+
+// IsEmpty reports whether the account holds nothing; empty accounts are
+// left out of the state tree
+func (a *Account) IsEmpty() bool {
+	return a.Balance == 0 && a.Stake == 0 && a.Nonce == 0 && a.ValidatorKey == "" &&
+		a.Commission == 0 && !a.Tombstoned && len(a.Delegations) == 0 && len(a.Unbonding) == 0 &&
+		len(a.Assets) == 0
+}
+
+// Encode returns the account's canonical leaf value in the state tree
+func (a *Account) Encode() []byte {
+	enc := codec.NewEncoder()
+	enc.WriteUint64(a.Balance)
+	enc.WriteUint64(a.Stake)
+	enc.WriteUint64(a.Nonce)
+	enc.WriteString(a.ValidatorKey)
+	enc.WriteUint64(a.Commission)
+	enc.WriteBool(a.Tombstoned)
+	enc.WriteUint32(uint32(len(a.Delegations)))
+	for _, delegation := range a.Delegations {
+		enc.WriteString(delegation.Validator)
+		enc.WriteUint64(delegation.Amount)
+	}
+	enc.WriteUint32(uint32(len(a.Unbonding)))
+	for _, entry := range a.Unbonding {
+		enc.WriteString(entry.Validator)
+		enc.WriteUint64(entry.Amount)
+		enc.WriteUint64(entry.CompletionHeight)
+	}
+	enc.WriteUint32(uint32(len(a.Assets)))
+	for _, balance := range a.Assets {
+		enc.WriteString(balance.Asset)
+		enc.WriteUint64(balance.Amount)
+	}
+	return enc.Bytes()
+}
+
+// GetAccount returns the committed account data for an address
+func (s *State) GetAccount(address string) *Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.account(address)
+}
+
+// account returns account data; callers must hold s.mu
+func (s *State) account(address string) *Account {
+	return &Account{
+		Balance:      s.Balances[address],
+		Stake:        s.Stakes[address],
+		Nonce:        s.Nonces[address],
+		ValidatorKey: s.ValidatorKeys[address],
+		Commission:   s.Commissions[address],
+		Tombstoned:   s.Tombstoned[address],
+		Delegations:  s.delegations(address),
+		Unbonding:    append([]UnbondingEntry(nil), s.Unbonding[address]...),
+		Assets:       s.assetBalances(address),
+	}
+}
+
+// touch marks the tree key of an account, asset or HTLC as changed since
+// the state tree was last updated; callers must hold s.mu
+func (s *State) touch(key string) {
+	if s.dirty == nil {
+		s.dirty = make(map[string]bool)
+	}
+	s.dirty[key] = true
+}
+
+// leafValue returns the value a tree key commits to, nil when the key is
+// empty; callers must hold s.mu
+func (s *State) leafValue(key string) []byte {
+	if symbol, ok := strings.CutPrefix(key, assetKeyPrefix); ok {
+		if asset, ok := s.Assets[symbol]; ok {
+			return asset.Encode()
+		}
+	}
+	if id, ok := strings.CutPrefix(key, htlcKeyPrefix); ok {
+		if htlc, ok := s.HTLCs[id]; ok {
+			return htlc.Encode()
+		}
+	}
+	if account := s.account(key); !account.IsEmpty() {
+		return account.Encode()
+	}
+	return nil
+}
+
+// buildTree builds the sparse Merkle tree over all non-empty accounts,
+// issued asset definitions and open HTLCs; callers must hold s.mu
+func (s *State) buildTree() *crypto.SparseMerkleTree {
+	keys := make(map[string]struct{})
+	for addr := range s.Balances {
+		keys[addr] = struct{}{}
+	}
+	for addr := range s.Stakes {
+		keys[addr] = struct{}{}
+	}
+	for addr := range s.Nonces {
+		keys[addr] = struct{}{}
+	}
+	for addr := range s.ValidatorKeys {
+		keys[addr] = struct{}{}
+	}
+	for addr := range s.Unbonding {
+		keys[addr] = struct{}{}
+	}
+	for addr := range s.Delegations {
+		keys[addr] = struct{}{}
+	}
+	for addr := range s.Commissions {
+		keys[addr] = struct{}{}
+	}
+	for addr := range s.Tombstoned {
+		keys[addr] = struct{}{}
+	}
+	for addr := range s.AssetBalances {
+		keys[addr] = struct{}{}
+	}
+	for symbol := range s.Assets {
+		keys[assetKeyPrefix+symbol] = struct{}{}
+	}
+	for id := range s.HTLCs {
+		keys[htlcKeyPrefix+id] = struct{}{}
+	}
+
+	tree := crypto.NewSparseMerkleTree()
+	for key := range keys {
+		if value := s.leafValue(key); value != nil {
+			tree.Update([]byte(key), value)
+		}
+	}
+	return tree
+}
+
+// currentTree brings the state tree up to date and returns a copy of it.
+// The tree is built in full the first time; after that only the keys
+// changed since the last update are rehashed.
+func (s *State) currentTree() *crypto.SparseMerkleTree {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tree == nil {
+		s.tree = s.buildTree()
+	} else {
+		for key := range s.dirty {
+			s.tree.Update([]byte(key), s.leafValue(key))
+		}
+	}
+	s.dirty = nil
+	return s.tree.Copy()
+}
+
+// Root returns the hex-encoded state root committing to every account,
+// issued asset and open HTLC
+func (s *State) Root() string {
+	return hex.EncodeToString(s.currentTree().Root())
+}
+
+// ProveAccount returns an account and its proof against the current root
+func (s *State) ProveAccount(address string) (*Account, *crypto.SparseMerkleProof) {
+	return s.GetAccount(address), s.currentTree().Prove([]byte(address))
+}
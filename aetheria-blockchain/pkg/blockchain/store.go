@@ -0,0 +1,230 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// blockStoreFile is the name of the block log inside a data directory
+	blockStoreFile = "blocks.dat"
+	// recordHeaderSize is the size of a record header: payload length + CRC32
+	recordHeaderSize = 8
+	// maxRecordSize bounds a single record to protect against corrupt headers
+	maxRecordSize = 64 << 20
+)
+
+// BlockStore persists blocks in the order they were accepted. A block is
+// appended a second time, with its Commit set, once it becomes final.
+type BlockStore interface {
+	// Append durably stores a block at the end of the store
+	Append(block *Block) error
+	// Blocks returns every stored block in insertion order
+	Blocks() ([]*Block, error)
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// MemoryBlockStore keeps blocks in memory only (useful for tests)
+type MemoryBlockStore struct {
+	blocks []*Block
+	mu     sync.RWMutex
+}
+
+// NewMemoryBlockStore creates an empty in-memory block store
+func NewMemoryBlockStore() *MemoryBlockStore {
+	return &MemoryBlockStore{
+		blocks: make([]*Block, 0),
+	}
+}
+
+// Append adds a block to the store
+func (m *MemoryBlockStore) Append(block *Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocks = append(m.blocks, block)
+	return nil
+}
+
+// Blocks returns all stored blocks
+func (m *MemoryBlockStore) Blocks() ([]*Block, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	blocks := make([]*Block, len(m.blocks))
+	copy(blocks, m.blocks)
+	return blocks, nil
+}
+
+// Close is a no-op for the in-memory store
+func (m *MemoryBlockStore) Close() error {
+	return nil
+}
+
+// FileBlockStore is an append-only block log on disk.
+//
+// Each record is laid out as [length uint32][crc32 uint32][payload], where
+// the payload is Block.Serialize output. Records are fsynced on append, and a
+// torn or corrupt record at the tail (left behind by a crash mid-write) is
+// truncated away when the store is opened. A corrupt record anywhere else
+// fails the open rather than discarding the blocks after it.
+type FileBlockStore struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// OpenFileBlockStore opens (or creates) the block log in dataDir
+func OpenFileBlockStore(dataDir string) (*FileBlockStore, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	path := filepath.Join(dataDir, blockStoreFile)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open block store: %w", err)
+	}
+
+	store := &FileBlockStore{
+		path: path,
+		file: file,
+	}
+
+	// Drop any partially written record left by a crash
+	validSize, err := store.scan(nil)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(validSize); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate block store: %w", err)
+	}
+	if _, err := file.Seek(validSize, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek block store: %w", err)
+	}
+
+	return store, nil
+}
+
+// Append writes a block record and syncs it to disk
+func (fs *FileBlockStore) Append(block *Block) error {
+	payload, err := block.Serialize()
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxRecordSize {
+		return fmt.Errorf("block %d too large to store: %d bytes", block.Index, len(payload))
+	}
+
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, err := fs.file.Write(record); err != nil {
+		return fmt.Errorf("failed to write block %d: %w", block.Index, err)
+	}
+	if err := fs.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync block store: %w", err)
+	}
+	return nil
+}
+
+// Blocks reads every block from the log
+func (fs *FileBlockStore) Blocks() ([]*Block, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	blocks := make([]*Block, 0)
+	_, err := fs.scan(func(block *Block) {
+		blocks = append(blocks, block)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// Close closes the underlying file
+func (fs *FileBlockStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.file.Close()
+}
+
+// scan walks the log from the start, calling fn for each intact block, and
+// returns the offset just past the last intact record. A bad record is only
+// a torn write, and tolerated, if it runs to the end of the file: one
+// followed by further records means the log itself is corrupt.
+func (fs *FileBlockStore) scan(fn func(*Block)) (int64, error) {
+	reader, err := os.Open(fs.path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read block store: %w", err)
+	}
+	defer reader.Close()
+
+	info, err := reader.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read block store: %w", err)
+	}
+	fileSize := info.Size()
+
+	buffered := bufio.NewReader(reader)
+	header := make([]byte, recordHeaderSize)
+	var offset int64
+
+	// bad reports a bad record at offset of the given size
+	bad := func(size uint32, reason string) (int64, error) {
+		if offset+int64(recordHeaderSize)+int64(size) >= fileSize {
+			return offset, nil
+		}
+		return 0, fmt.Errorf("block store is corrupt at offset %d: %s", offset, reason)
+	}
+
+	for {
+		if _, err := io.ReadFull(buffered, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return 0, fmt.Errorf("failed to read block store: %w", err)
+		}
+
+		size := binary.BigEndian.Uint32(header[0:4])
+		checksum := binary.BigEndian.Uint32(header[4:8])
+		if size > maxRecordSize {
+			return bad(size, fmt.Sprintf("record of %d bytes exceeds the limit", size))
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(buffered, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, nil
+			}
+			return 0, fmt.Errorf("failed to read block store: %w", err)
+		}
+		if crc32.ChecksumIEEE(payload) != checksum {
+			return bad(size, "checksum mismatch")
+		}
+
+		block, err := DeserializeBlock(payload)
+		if err != nil {
+			return bad(size, err.Error())
+		}
+		if fn != nil {
+			fn(block)
+		}
+		offset += int64(recordHeaderSize) + int64(size)
+	}
+}
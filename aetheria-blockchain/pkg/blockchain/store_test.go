@@ -0,0 +1,121 @@
+package blockchain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestLog stores n blocks in a new log in dir and returns its contents
+func writeTestLog(t *testing.T, dir string, n int) []byte {
+	t.Helper()
+	store, err := OpenFileBlockStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := store.Append(&Block{Index: uint64(i), Hash: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, blockStoreFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// reopenTestLog replaces the log in dir with data and opens it
+func reopenTestLog(t *testing.T, dir string, data []byte) (*FileBlockStore, error) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, blockStoreFile), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return OpenFileBlockStore(dir)
+}
+
+func TestFileBlockStoreDropsTornTail(t *testing.T) {
+	dir := t.TempDir()
+	data := writeTestLog(t, dir, 3)
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-2] ^= 0xff
+	for name, tail := range map[string][]byte{
+		"torn":    data[:len(data)-3],
+		"corrupt": corrupt,
+	} {
+		store, err := reopenTestLog(t, dir, tail)
+		if err != nil {
+			t.Fatalf("%s tail: %v", name, err)
+		}
+		blocks, err := store.Blocks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blocks) != 2 {
+			t.Fatalf("%s tail: expected the 2 intact blocks, got %d", name, len(blocks))
+		}
+
+		// The next append lands right after the intact records
+		if err := store.Append(&Block{Index: 2, Hash: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+		if blocks, _ := store.Blocks(); len(blocks) != 3 {
+			t.Fatalf("%s tail: expected 3 blocks after appending, got %d", name, len(blocks))
+		}
+		store.Close()
+	}
+}
+
+func TestFileBlockStoreRefusesCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	data := writeTestLog(t, dir, 3)
+
+	// Damage the first record's payload, with two good records after it
+	corrupt := append([]byte(nil), data...)
+	corrupt[recordHeaderSize+4] ^= 0xff
+	if _, err := reopenTestLog(t, dir, corrupt); err == nil {
+		t.Fatal("expected a corrupt record before the tail to fail the open")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, blockStoreFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(corrupt)) {
+		t.Fatalf("log truncated to %d bytes, want %d left alone", info.Size(), len(corrupt))
+	}
+}
+
+func TestChainReopensFromFileStore(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	genesis := newTestGenesis(keys)
+	dir := t.TempDir()
+
+	store, err := OpenFileBlockStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := newTestChain(t, genesis, store, nil)
+	for i := 0; i < 3; i++ {
+		mineBlock(t, bc, keys)
+	}
+	head := bc.GetLatestBlock()
+	root := head.StateRoot
+	store.Close()
+
+	store, err = OpenFileBlockStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	bc = newTestChain(t, genesis, store, nil)
+	if bc.GetLatestBlock().Hash != head.Hash {
+		t.Fatalf("expected head %s after reopening, got %s", head.Hash, bc.GetLatestBlock().Hash)
+	}
+	if got := bc.HeadState().Root(); got != root {
+		t.Fatalf("state root %s after reopening, want %s", got, root)
+	}
+}
@@ -6,51 +6,168 @@ import (
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/aetheria/blockchain/pkg/crypto"
 )
 
-// Transaction represents a transfer of Aetheria tokens
+// Transaction represents a signed operation on Aetheria tokens
 type Transaction struct {
-	ID        string    `json:"id"`
-	From      string    `json:"from"`
-	To        string    `json:"to"`
-	Amount    uint64    `json:"amount"`
-	Fee       uint64    `json:"fee"`
-	Timestamp int64     `json:"timestamp"`
-	Signature string    `json:"signature"`
-	PublicKey string    `json:"public_key"`
-}
-
-// NewTransaction creates a new transaction
-func NewTransaction(from, to string, amount, fee uint64) *Transaction {
+	ID         string `json:"id"`
+	ChainID    string `json:"chain_id"` // network the transaction is valid on
+	Type       TxType `json:"type"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Amount     uint64 `json:"amount"`
+	Fee        uint64 `json:"fee"`
+	Nonce      uint64 `json:"nonce"`
+	Timestamp  int64  `json:"timestamp"`
+	Asset      string `json:"asset,omitempty"`       // issued asset symbol, for asset transactions
+	Decimals   uint8  `json:"decimals,omitempty"`    // for TxIssueAsset
+	MaxSupply  uint64 `json:"max_supply,omitempty"`  // for TxIssueAsset (0 means uncapped)
+	HashLock   string `json:"hash_lock,omitempty"`   // hex SHA-256, for TxLockHTLC
+	Expiry     uint64 `json:"expiry,omitempty"`      // for TxLockHTLC
+	Preimage   string `json:"preimage,omitempty"`    // hex, for TxClaimHTLC
+	ContractID string `json:"contract_id,omitempty"` // HTLC lock transaction ID, for TxClaimHTLC and TxRefundHTLC
+	Signature  string `json:"signature"`
+	PublicKey  string `json:"public_key"`
+}
+
+// NewTransaction creates a new transfer on the chain identified by chainID.
+// nonce must equal the number of transactions the sender has already had
+// included in the chain.
+func NewTransaction(chainID, from, to string, amount, fee, nonce uint64) *Transaction {
+	return newTypedTransaction(chainID, TxTransfer, from, to, amount, fee, nonce)
+}
+
+// NewStakeTransaction creates a transaction bonding amount of from's balance
+func NewStakeTransaction(chainID, from string, amount, fee, nonce uint64) *Transaction {
+	return newTypedTransaction(chainID, TxStake, from, "", amount, fee, nonce)
+}
+
+// NewUnstakeTransaction creates a transaction releasing amount of from's stake
+func NewUnstakeTransaction(chainID, from string, amount, fee, nonce uint64) *Transaction {
+	return newTypedTransaction(chainID, TxUnstake, from, "", amount, fee, nonce)
+}
+
+// NewDelegateTransaction creates a transaction bonding amount of from's
+// balance to validator
+func NewDelegateTransaction(chainID, from, validator string, amount, fee, nonce uint64) *Transaction {
+	return newTypedTransaction(chainID, TxDelegate, from, validator, amount, fee, nonce)
+}
+
+// NewUndelegateTransaction creates a transaction releasing amount of from's
+// delegation to validator
+func NewUndelegateTransaction(chainID, from, validator string, amount, fee, nonce uint64) *Transaction {
+	return newTypedTransaction(chainID, TxUndelegate, from, validator, amount, fee, nonce)
+}
+
+// NewSetCommissionTransaction creates a transaction setting from's validator
+// commission, in basis points of each block's rewards
+func NewSetCommissionTransaction(chainID, from string, rate, fee, nonce uint64) *Transaction {
+	return newTypedTransaction(chainID, TxSetCommission, from, "", rate, fee, nonce)
+}
+
+// NewIssueAssetTransaction creates a transaction defining asset symbol,
+// issued by from, and crediting from with an initial supply of amount
+func NewIssueAssetTransaction(chainID, from, symbol string, decimals uint8, maxSupply, amount, fee, nonce uint64) *Transaction {
+	tx := newTypedTransaction(chainID, TxIssueAsset, from, "", amount, fee, nonce)
+	tx.Asset = symbol
+	tx.Decimals = decimals
+	tx.MaxSupply = maxSupply
+	tx.ID = tx.calculateID()
+	return tx
+}
+
+// NewMintAssetTransaction creates a transaction issuing amount more of
+// from's asset symbol to to
+func NewMintAssetTransaction(chainID, from, to, symbol string, amount, fee, nonce uint64) *Transaction {
+	return newAssetTransaction(chainID, TxMintAsset, from, to, symbol, amount, fee, nonce)
+}
+
+// NewBurnAssetTransaction creates a transaction destroying amount of from's
+// holding of asset symbol
+func NewBurnAssetTransaction(chainID, from, symbol string, amount, fee, nonce uint64) *Transaction {
+	return newAssetTransaction(chainID, TxBurnAsset, from, "", symbol, amount, fee, nonce)
+}
+
+// NewTransferAssetTransaction creates a transaction moving amount of asset
+// symbol from from to to
+func NewTransferAssetTransaction(chainID, from, to, symbol string, amount, fee, nonce uint64) *Transaction {
+	return newAssetTransaction(chainID, TxTransferAsset, from, to, symbol, amount, fee, nonce)
+}
+
+// NewLockHTLCTransaction creates a transaction locking amount of from's
+// native token, or of asset when it is non-empty, in a contract to can
+// claim by revealing the preimage of hashLock before height expiry
+func NewLockHTLCTransaction(chainID, from, to, asset, hashLock string, amount, expiry, fee, nonce uint64) *Transaction {
+	tx := newTypedTransaction(chainID, TxLockHTLC, from, to, amount, fee, nonce)
+	tx.Asset = asset
+	tx.HashLock = hashLock
+	tx.Expiry = expiry
+	tx.ID = tx.calculateID()
+	return tx
+}
+
+// NewClaimHTLCTransaction creates a transaction claiming contract
+// contractID for its recipient from by revealing preimage (hex)
+func NewClaimHTLCTransaction(chainID, from, contractID, preimage string, fee, nonce uint64) *Transaction {
+	tx := newTypedTransaction(chainID, TxClaimHTLC, from, "", 0, fee, nonce)
+	tx.ContractID = contractID
+	tx.Preimage = preimage
+	tx.ID = tx.calculateID()
+	return tx
+}
+
+// NewRefundHTLCTransaction creates a transaction returning expired contract
+// contractID to its sender from
+func NewRefundHTLCTransaction(chainID, from, contractID string, fee, nonce uint64) *Transaction {
+	tx := newTypedTransaction(chainID, TxRefundHTLC, from, "", 0, fee, nonce)
+	tx.ContractID = contractID
+	tx.ID = tx.calculateID()
+	return tx
+}
+
+// newAssetTransaction creates an unsigned transaction of the given type
+// acting on an issued asset
+func newAssetTransaction(chainID string, txType TxType, from, to, symbol string, amount, fee, nonce uint64) *Transaction {
+	tx := newTypedTransaction(chainID, txType, from, to, amount, fee, nonce)
+	tx.Asset = symbol
+	tx.ID = tx.calculateID()
+	return tx
+}
+
+// newTypedTransaction creates an unsigned transaction of the given type
+func newTypedTransaction(chainID string, txType TxType, from, to string, amount, fee, nonce uint64) *Transaction {
 	tx := &Transaction{
+		ChainID:   chainID,
+		Type:      txType,
 		From:      from,
 		To:        to,
 		Amount:    amount,
 		Fee:       fee,
+		Nonce:     nonce,
 		Timestamp: time.Now().Unix(),
 	}
 	tx.ID = tx.calculateID()
 	return tx
 }
 
-// calculateID generates transaction ID from its data
+// calculateID generates transaction ID from its canonical encoding
 func (tx *Transaction) calculateID() string {
-	data := fmt.Sprintf("%s%s%d%d%d", tx.From, tx.To, tx.Amount, tx.Fee, tx.Timestamp)
-	return crypto.HashString([]byte(data))
+	return crypto.HashString(tx.EncodeBody())
 }
 
 // Sign signs the transaction with private key
 func (tx *Transaction) Sign(privateKey ed25519.PrivateKey) error {
 	publicKey := privateKey.Public().(ed25519.PublicKey)
 	tx.PublicKey = crypto.PublicKeyToHex(publicKey)
-	
+
 	data := tx.dataToSign()
 	signature := crypto.Sign(privateKey, data)
 	tx.Signature = crypto.SignatureToHex(signature)
-	
+
 	return nil
 }
 
@@ -60,6 +177,10 @@ func (tx *Transaction) Verify() error {
 		return fmt.Errorf("transaction not signed")
 	}
 
+	if tx.ID != tx.calculateID() {
+		return fmt.Errorf("transaction ID does not match its contents")
+	}
+
 	publicKey, err := crypto.PublicKeyFromHex(tx.PublicKey)
 	if err != nil {
 		return fmt.Errorf("invalid public key: %w", err)
@@ -86,8 +207,7 @@ func (tx *Transaction) Verify() error {
 
 // dataToSign returns the data to be signed
 func (tx *Transaction) dataToSign() []byte {
-	data := fmt.Sprintf("%s%s%s%d%d%d", tx.ID, tx.From, tx.To, tx.Amount, tx.Fee, tx.Timestamp)
-	return []byte(data)
+	return tx.EncodeBody()
 }
 
 // Serialize serializes transaction to bytes
@@ -121,6 +241,77 @@ func (tx *Transaction) HashString() string {
 	return hex.EncodeToString(tx.Hash())
 }
 
+// Cost returns the balance the sender needs for the transaction to apply.
+// A cost too large for a uint64 is reported as math.MaxUint64; checkCost
+// rejects such transactions.
+func (tx *Transaction) Cost() uint64 {
+	switch tx.Type {
+	case TxUnstake, TxUndelegate, TxSetCommission,
+		TxIssueAsset, TxMintAsset, TxBurnAsset, TxTransferAsset,
+		TxClaimHTLC, TxRefundHTLC:
+		// Nothing but the fee is paid in the native token
+		return tx.Fee
+	case TxLockHTLC:
+		if tx.Asset != "" {
+			return tx.Fee
+		}
+		return tx.amountPlusFee()
+	default:
+		return tx.amountPlusFee()
+	}
+}
+
+// amountPlusFee returns Amount+Fee, or math.MaxUint64 if the sum overflows
+func (tx *Transaction) amountPlusFee() uint64 {
+	if tx.Amount > math.MaxUint64-tx.Fee {
+		return math.MaxUint64
+	}
+	return tx.Amount + tx.Fee
+}
+
+// checkCost rejects a transaction whose amount and fee overflow together,
+// whatever its type, so no balance arithmetic on it can wrap around
+func (tx *Transaction) checkCost() error {
+	if tx.Amount > math.MaxUint64-tx.Fee {
+		return fmt.Errorf("amount %d plus fee %d overflows", tx.Amount, tx.Fee)
+	}
+	return nil
+}
+
+// checkFields rejects optional fields that the transaction's type does not
+// use, so every signed field has a meaning
+func (tx *Transaction) checkFields() error {
+	var asset, issue, hashLock, expiry, preimage, contract bool
+	switch tx.Type {
+	case TxIssueAsset:
+		asset, issue = true, true
+	case TxMintAsset, TxBurnAsset, TxTransferAsset:
+		asset = true
+	case TxLockHTLC:
+		asset, hashLock, expiry = true, true, true
+	case TxClaimHTLC:
+		preimage, contract = true, true
+	case TxRefundHTLC:
+		contract = true
+	}
+
+	switch {
+	case !asset && tx.Asset != "":
+		return fmt.Errorf("%s transaction cannot set an asset", tx.Type)
+	case !issue && (tx.Decimals != 0 || tx.MaxSupply != 0):
+		return fmt.Errorf("%s transaction cannot set decimals or max supply", tx.Type)
+	case !hashLock && tx.HashLock != "":
+		return fmt.Errorf("%s transaction cannot set a hash lock", tx.Type)
+	case !expiry && tx.Expiry != 0:
+		return fmt.Errorf("%s transaction cannot set an expiry", tx.Type)
+	case !preimage && tx.Preimage != "":
+		return fmt.Errorf("%s transaction cannot set a preimage", tx.Type)
+	case !contract && tx.ContractID != "":
+		return fmt.Errorf("%s transaction cannot set a contract ID", tx.Type)
+	}
+	return nil
+}
+
 // IsCoinbase checks if transaction is a coinbase (mining reward)
 func (tx *Transaction) IsCoinbase() bool {
 	return tx.From == ""
@@ -0,0 +1,46 @@
+package blockchain
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCostOverflowIsRejected(t *testing.T) {
+	keys := newTestKeys(t, 2)
+	from, to := keys[0].Address(), keys[1].Address()
+
+	// Amount+Fee wraps around to 4, which the sender could afford
+	transfer := NewTransaction(testChainID, from, to, math.MaxUint64-5, 10, 0)
+	lock := NewLockHTLCTransaction(testChainID, from, to, "", HashLockOf([]byte("secret")), math.MaxUint64-5, 10, 10, 0)
+
+	for _, tx := range []*Transaction{transfer, lock} {
+		if cost := tx.Cost(); cost != math.MaxUint64 {
+			t.Errorf("%s cost = %d, want %d", tx.Type, cost, uint64(math.MaxUint64))
+		}
+
+		state := newTestGenesis(keys).State()
+		if _, err := state.ApplyTransaction(tx); err == nil {
+			t.Errorf("expected %s overflowing its cost to be invalid", tx.Type)
+		}
+		if balance := state.GetBalance(to); balance != 1000000 {
+			t.Errorf("%s changed the recipient's balance to %d", tx.Type, balance)
+		}
+
+		if err := tx.Sign(keys[0].PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewMempool(DefaultMempoolConfig()).Add(tx, state); err == nil {
+			t.Errorf("expected the mempool to refuse %s overflowing its cost", tx.Type)
+		}
+	}
+}
+
+func TestCostWithinRange(t *testing.T) {
+	tx := NewTransaction(testChainID, "alice", "bob", math.MaxUint64-10, 10, 0)
+	if cost := tx.Cost(); cost != math.MaxUint64 {
+		t.Errorf("cost = %d, want %d", cost, uint64(math.MaxUint64))
+	}
+	if err := tx.checkCost(); err != nil {
+		t.Errorf("expected a cost of exactly MaxUint64 to be valid: %v", err)
+	}
+}
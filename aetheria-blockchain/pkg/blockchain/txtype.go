@@ -0,0 +1,94 @@
+package blockchain
+
+import "fmt"
+
+// TxType identifies what a transaction does when applied to the state
+type TxType uint8
+
+const (
+	// TxTransfer moves Amount from From to To
+	TxTransfer TxType = iota
+	// TxStake bonds Amount of From's balance as validator stake
+	TxStake
+	// TxUnstake moves Amount of From's stake into the unbonding queue
+	TxUnstake
+	// TxDelegate bonds Amount of From's balance to validator To
+	TxDelegate
+	// TxUndelegate moves Amount of From's delegation to validator To into the
+	// unbonding queue
+	TxUndelegate
+	// TxSetCommission sets From's validator commission to Amount basis points
+	TxSetCommission
+	// TxIssueAsset defines asset Asset, issued by From, and credits From with
+	// an initial supply of Amount
+	TxIssueAsset
+	// TxMintAsset issues Amount more of From's asset Asset to To (From when
+	// To is empty)
+	TxMintAsset
+	// TxBurnAsset destroys Amount of From's holding of asset Asset
+	TxBurnAsset
+	// TxTransferAsset moves Amount of asset Asset from From to To
+	TxTransferAsset
+	// TxLockHTLC locks Amount of From's native token, or of asset Asset, in
+	// a contract To can claim with the preimage of HashLock before height
+	// Expiry
+	TxLockHTLC
+	// TxClaimHTLC pays contract ContractID to From, its recipient, who
+	// reveals the Preimage of its hash lock
+	TxClaimHTLC
+	// TxRefundHTLC returns expired contract ContractID to From, its sender
+	TxRefundHTLC
+)
+
+// txTypeNames maps transaction types to their names
+var txTypeNames = map[TxType]string{
+	TxTransfer:      "transfer",
+	TxStake:         "stake",
+	TxUnstake:       "unstake",
+	TxDelegate:      "delegate",
+	TxUndelegate:    "undelegate",
+	TxSetCommission: "set_commission",
+	TxIssueAsset:    "issue_asset",
+	TxMintAsset:     "mint_asset",
+	TxBurnAsset:     "burn_asset",
+	TxTransferAsset: "transfer_asset",
+	TxLockHTLC:      "htlc_lock",
+	TxClaimHTLC:     "htlc_claim",
+	TxRefundHTLC:    "htlc_refund",
+}
+
+// String returns the name of the transaction type
+func (t TxType) String() string {
+	if name, ok := txTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(t))
+}
+
+// ParseTxType parses a transaction type name
+func ParseTxType(name string) (TxType, error) {
+	for t, n := range txTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown transaction type %q", name)
+}
+
+// MarshalText encodes the type as its name (used by JSON)
+func (t TxType) MarshalText() ([]byte, error) {
+	if _, ok := txTypeNames[t]; !ok {
+		return nil, fmt.Errorf("unknown transaction type %d", uint8(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a type name
+func (t *TxType) UnmarshalText(text []byte) error {
+	parsed, err := ParseTxType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
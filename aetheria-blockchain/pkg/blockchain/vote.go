@@ -0,0 +1,173 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+// VoteType is the step of a consensus round a vote belongs to
+type VoteType uint8
+
+const (
+	// VotePrevote is a validator's first vote in a round, for the block it
+	// saw proposed
+	VotePrevote VoteType = 1
+	// VotePrecommit is a validator's second vote in a round, cast once more
+	// than 2/3 of the voting power prevoted for the block
+	VotePrecommit VoteType = 2
+)
+
+// voteTypeNames maps vote types to their names
+var voteTypeNames = map[VoteType]string{
+	VotePrevote:   "prevote",
+	VotePrecommit: "precommit",
+}
+
+// String returns the name of the vote type
+func (t VoteType) String() string {
+	if name, ok := voteTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(t))
+}
+
+// MarshalText encodes the type as its name (used by JSON)
+func (t VoteType) MarshalText() ([]byte, error) {
+	if _, ok := voteTypeNames[t]; !ok {
+		return nil, fmt.Errorf("unknown vote type %d", uint8(t))
+	}
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a type name
+func (t *VoteType) UnmarshalText(text []byte) error {
+	for voteType, name := range voteTypeNames {
+		if name == string(text) {
+			*t = voteType
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown vote type %q", text)
+}
+
+// Vote is a validator's signed prevote or precommit for a block in a
+// consensus round
+type Vote struct {
+	ChainID   string   `json:"chain_id"`
+	Type      VoteType `json:"type"`
+	Height    uint64   `json:"height"`
+	Round     uint32   `json:"round"`
+	BlockHash string   `json:"block_hash"`
+	Validator string   `json:"validator"`
+	Signature string   `json:"signature"`
+}
+
+// NewVote creates an unsigned vote by validator for the block with
+// blockHash at height
+func NewVote(chainID string, voteType VoteType, height uint64, round uint32, blockHash, validator string) *Vote {
+	return &Vote{
+		ChainID:   chainID,
+		Type:      voteType,
+		Height:    height,
+		Round:     round,
+		BlockHash: blockHash,
+		Validator: validator,
+	}
+}
+
+// Sign signs the vote with the validator's private key
+func (v *Vote) Sign(privateKey []byte) error {
+	signature := crypto.Sign(privateKey, v.Encode())
+	v.Signature = crypto.SignatureToHex(signature)
+	return nil
+}
+
+// Verify checks that the vote is signed by the holder of publicKey
+func (v *Vote) Verify(publicKey string) error {
+	key, err := crypto.PublicKeyFromHex(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid validator key: %w", err)
+	}
+	signature, err := crypto.SignatureFromHex(v.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid vote signature: %w", err)
+	}
+	if !crypto.Verify(key, v.Encode(), signature) {
+		return fmt.Errorf("%s not signed by %s", v.Type, v.Validator)
+	}
+	return nil
+}
+
+// Commit holds the precommits that made a block final: one per validator,
+// all for the same block and round, from more than 2/3 of the voting power
+// of the state the block produces
+type Commit struct {
+	Height     uint64  `json:"height"`
+	Round      uint32  `json:"round"`
+	BlockHash  string  `json:"block_hash"`
+	Precommits []*Vote `json:"precommits"`
+}
+
+// NewCommit creates a commit from precommits for the block with blockHash
+func NewCommit(height uint64, round uint32, blockHash string, precommits []*Vote) *Commit {
+	return &Commit{
+		Height:     height,
+		Round:      round,
+		BlockHash:  blockHash,
+		Precommits: precommits,
+	}
+}
+
+// HasSupermajority reports whether power is more than 2/3 of total
+func HasSupermajority(power, total uint64) bool {
+	// Compare power*3 with total*2 without overflowing
+	hi1, lo1 := bits.Mul64(power, 3)
+	hi2, lo2 := bits.Mul64(total, 2)
+	return total > 0 && (hi1 > hi2 || (hi1 == hi2 && lo1 > lo2))
+}
+
+// verifyCommit checks that commit finalizes block: every precommit is a
+// distinct active validator's signed precommit for the block in the commit's
+// round, and together they hold more than 2/3 of the voting power of state,
+// the state the block produces
+func verifyCommit(commit *Commit, block *Block, state *State) error {
+	if commit.BlockHash != block.Hash || commit.Height != block.Index {
+		return fmt.Errorf("commit is for block %d %s, not %d %s", commit.Height, commit.BlockHash, block.Index, block.Hash)
+	}
+
+	validators := make(map[string]ActiveValidator)
+	var total uint64
+	for _, v := range state.ActiveValidators() {
+		validators[v.Address] = v
+		total += v.Power()
+	}
+
+	var signed uint64
+	seen := make(map[string]bool, len(commit.Precommits))
+	for _, vote := range commit.Precommits {
+		if vote.Type != VotePrecommit || vote.ChainID != block.ChainID || vote.Height != commit.Height ||
+			vote.Round != commit.Round || vote.BlockHash != commit.BlockHash {
+			return fmt.Errorf("vote by %s does not match the commit", vote.Validator)
+		}
+		if seen[vote.Validator] {
+			return fmt.Errorf("validator %s precommitted twice", vote.Validator)
+		}
+		seen[vote.Validator] = true
+
+		validator, ok := validators[vote.Validator]
+		if !ok {
+			return fmt.Errorf("%s is not a validator", vote.Validator)
+		}
+		if err := vote.Verify(validator.PublicKey); err != nil {
+			return err
+		}
+		signed += validator.Power()
+	}
+
+	if !HasSupermajority(signed, total) {
+		return fmt.Errorf("precommits hold %d of %d voting power, need more than 2/3", signed, total)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Package codec implements Aetheria's canonical binary encoding.
+//
+// Every value has exactly one encoding, and no two different sequences of
+// values encode to the same bytes:
+//
+//   - integers are fixed-width big-endian (int64 as two's complement)
+//   - byte strings and text are a uint32 big-endian length followed by the
+//     raw bytes
+//
+// Hashing and signing preimages are built with an Encoder so that clients
+// in other languages can reproduce them exactly. See docs/ENCODING.md.
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Encoder appends canonically encoded values to a buffer
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+// NewEncoder creates an empty encoder
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// WriteUint8 appends a single byte
+func (e *Encoder) WriteUint8(v uint8) {
+	e.buf.WriteByte(v)
+}
+
+// WriteUint32 appends a 4-byte big-endian integer
+func (e *Encoder) WriteUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+// WriteUint64 appends an 8-byte big-endian integer
+func (e *Encoder) WriteUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+// WriteInt64 appends an 8-byte big-endian two's complement integer
+func (e *Encoder) WriteInt64(v int64) {
+	e.WriteUint64(uint64(v))
+}
+
+// WriteBool appends 0x01 for true and 0x00 for false
+func (e *Encoder) WriteBool(v bool) {
+	if v {
+		e.WriteUint8(1)
+	} else {
+		e.WriteUint8(0)
+	}
+}
+
+// WriteBytes appends a length-prefixed byte string
+func (e *Encoder) WriteBytes(v []byte) {
+	e.WriteUint32(uint32(len(v)))
+	e.buf.Write(v)
+}
+
+// WriteString appends length-prefixed UTF-8 text
+func (e *Encoder) WriteString(v string) {
+	e.WriteUint32(uint32(len(v)))
+	e.buf.WriteString(v)
+}
+
+// Bytes returns the encoded data
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// Len returns the number of encoded bytes
+func (e *Encoder) Len() int {
+	return e.buf.Len()
+}
@@ -0,0 +1,459 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aetheria/blockchain/pkg/blockchain"
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+const (
+	// futureHeights is how far above the current height votes are held
+	// until their height starts
+	futureHeights = 16
+	// maxFutureVotes bounds the votes held per validator
+	maxFutureVotes = 64
+)
+
+// ErrKnownVote is returned for a vote that has already been counted
+var ErrKnownVote = errors.New("vote already known")
+
+// RoundStep is where this node is in the current consensus round
+type RoundStep uint8
+
+const (
+	// StepPropose waits for the round's block
+	StepPropose RoundStep = iota
+	// StepPrevote has prevoted and waits for 2/3 of the prevotes
+	StepPrevote
+	// StepPrecommit has precommitted and waits for 2/3 of the precommits
+	StepPrecommit
+	// StepCommit has seen the height's block committed
+	StepCommit
+)
+
+// voteSet tallies one kind of vote in one round
+type voteSet struct {
+	votes map[string]*blockchain.Vote // by validator
+	power map[string]uint64           // by block hash
+}
+
+// newVoteSet creates an empty tally
+func newVoteSet() *voteSet {
+	return &voteSet{
+		votes: make(map[string]*blockchain.Vote),
+		power: make(map[string]uint64),
+	}
+}
+
+// add counts a vote carrying power, rejecting a second vote by the same
+// validator
+func (vs *voteSet) add(vote *blockchain.Vote, power uint64) error {
+	if known, ok := vs.votes[vote.Validator]; ok {
+		if known.BlockHash == vote.BlockHash {
+			return ErrKnownVote
+		}
+		return fmt.Errorf("validator %s cast conflicting %ss in round %d", vote.Validator, vote.Type, vote.Round)
+	}
+	vs.votes[vote.Validator] = vote
+	vs.power[vote.BlockHash] += power
+	return nil
+}
+
+// majority returns the block more than 2/3 of total voted for, if any
+func (vs *voteSet) majority(total uint64) (string, bool) {
+	for hash, power := range vs.power {
+		if blockchain.HasSupermajority(power, total) {
+			return hash, true
+		}
+	}
+	return "", false
+}
+
+// votesFor returns the votes for a block, sorted by validator
+func (vs *voteSet) votesFor(blockHash string) []*blockchain.Vote {
+	votes := make([]*blockchain.Vote, 0)
+	for _, vote := range vs.votes {
+		if vote.BlockHash == blockHash {
+			votes = append(votes, vote)
+		}
+	}
+	sort.Slice(votes, func(i, j int) bool {
+		return votes[i].Validator < votes[j].Validator
+	})
+	return votes
+}
+
+// BlockTree answers ancestry questions about the blocks the chain knows
+type BlockTree interface {
+	// Extends reports whether the block with hash is the block with hash
+	// ancestor or descends from it
+	Extends(hash, ancestor string) bool
+}
+
+// BFT is a Tendermint-style finality gadget run on top of block production.
+// Each height runs in rounds: the canonical block at the height is the
+// round's proposal, validators prevote for it, precommit once more than 2/3
+// of the voting power prevoted for it, and the block is final once more
+// than 2/3 precommitted. A validator without a proposal votes for nil, an
+// empty block hash. A validator that precommits a block is locked on it and
+// prevotes only for it in later rounds of the height, until more than 2/3
+// prevote for another block or for nil in a round after the one it locked
+// in. A height is kept until it commits, and only proposals descending from
+// the last committed block are voted for.
+type BFT struct {
+	ChainID      string
+	RoundTimeout time.Duration // how long a round may run before the next starts
+	Chain        BlockTree
+
+	height      uint64
+	round       uint32
+	step        RoundStep
+	roundStart  time.Time
+	validators  *ValidatorSet
+	signer      *Validator        // nil when this node does not vote
+	proposal    *blockchain.Block // block voted on in the current round
+	committed   string            // hash of the newest block known to be committed
+	committedAt uint64            // height of that block
+	locked      string            // hash of the block this node is locked on
+	lockRound   uint32            // round in which it locked
+	prevotes    map[uint32]*voteSet
+	precommits  map[uint32]*voteSet
+	future      map[string][]*blockchain.Vote // votes for heights not started yet, by validator
+	mu          sync.Mutex
+}
+
+// NewBFT creates a finality gadget for the chain identified by chainID,
+// checking proposals against the blocks in chain
+func NewBFT(chainID string, roundTimeout time.Duration, chain BlockTree) *BFT {
+	return &BFT{
+		ChainID:      chainID,
+		RoundTimeout: roundTimeout,
+		Chain:        chain,
+		step:         StepCommit, // genesis is final
+		validators:   NewValidatorSet(),
+		prevotes:     make(map[uint32]*voteSet),
+		precommits:   make(map[uint32]*voteSet),
+		future:       make(map[string][]*blockchain.Vote),
+	}
+}
+
+// SetSigner makes the gadget vote as validator
+func (b *BFT) SetSigner(validator *Validator) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.signer = validator
+}
+
+// Status returns the current height, round and step
+func (b *BFT) Status() (uint64, uint32, RoundStep) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.height, b.round, b.step
+}
+
+// Propose offers the canonical block at a height for finalization. Once the
+// current height has committed, a block above it starts that height, voted
+// on by validators; votes already received for it are counted. Until then
+// only blocks at the current height are taken. A block that does not
+// descend from the last committed block is not voted for. It returns the
+// votes this node casts, to be broadcast, and a commit if one formed.
+func (b *BFT) Propose(block *blockchain.Block, validators *ValidatorSet) ([]*blockchain.Vote, *blockchain.Commit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if block.Index < b.height || (block.Index == b.height && (b.step == StepCommit || b.proposal != nil)) {
+		return nil, nil
+	}
+	// Leaving an uncommitted height would drop this node's lock, letting it
+	// vote for a branch conflicting with the block it precommitted
+	if block.Index > b.height && b.step != StepCommit {
+		return nil, nil
+	}
+
+	var cast []*blockchain.Vote
+	var commit *blockchain.Commit
+	if block.Index > b.height {
+		b.startHeight(block.Index, validators)
+		cast, commit = b.replayFuture()
+		if commit != nil {
+			return cast, commit
+		}
+	}
+
+	if b.extends(block) {
+		b.proposal = block
+	}
+	if b.step == StepPropose {
+		cast = append(cast, b.prevote()...)
+	}
+	more, commit := b.progress()
+	return append(cast, more...), commit
+}
+
+// AddVote counts a validator's vote. It returns the votes this node casts
+// in response, to be broadcast, and a commit if one formed. Votes for past
+// heights are ignored. Votes for the next few heights are verified against
+// the current validator set and held until their height starts.
+func (b *BFT) AddVote(vote *blockchain.Vote) ([]*blockchain.Vote, *blockchain.Commit, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if vote.ChainID != b.ChainID {
+		return nil, nil, fmt.Errorf("vote is for chain %q, not %q", vote.ChainID, b.ChainID)
+	}
+	if vote.Height < b.height || (vote.Height == b.height && b.step == StepCommit) {
+		return nil, nil, nil
+	}
+	if vote.Height > b.height {
+		if vote.Height > b.height+futureHeights {
+			return nil, nil, fmt.Errorf("vote for height %d is too far above height %d", vote.Height, b.height)
+		}
+		if _, err := b.verify(vote); err != nil {
+			return nil, nil, err
+		}
+		if len(b.future[vote.Validator]) >= maxFutureVotes {
+			return nil, nil, fmt.Errorf("too many future votes from %s", vote.Validator)
+		}
+		b.future[vote.Validator] = append(b.future[vote.Validator], vote)
+		return nil, nil, nil
+	}
+
+	if err := b.count(vote); err != nil {
+		return nil, nil, err
+	}
+	cast, commit := b.progress()
+	return cast, commit, nil
+}
+
+// Timeout starts the next round if the current one has run longer than
+// RoundTimeout without a commit. block is the canonical block at the
+// current height, which becomes the new round's proposal. It returns the
+// votes this node casts.
+func (b *BFT) Timeout(now time.Time, block *blockchain.Block) []*blockchain.Vote {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.height == 0 || b.step == StepCommit || now.Sub(b.roundStart) < b.RoundTimeout {
+		return nil
+	}
+
+	b.round++
+	b.step = StepPropose
+	b.roundStart = now
+	b.proposal = nil
+	if block != nil && block.Index == b.height && b.extends(block) {
+		b.proposal = block
+	}
+	return b.prevote()
+}
+
+// Finalized tells the gadget that block is final on the chain, for example
+// through a commit received from peers. Later proposals must descend from
+// it, and the height it is at, or any below it, is over.
+func (b *BFT) Finalized(block *blockchain.Block) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.committed != "" && block.Index <= b.committedAt {
+		return
+	}
+	b.committed = block.Hash
+	b.committedAt = block.Index
+
+	switch {
+	case block.Index > b.height:
+		b.startHeight(block.Index, b.validators)
+		b.step = StepCommit
+	case block.Index == b.height:
+		b.step = StepCommit
+	case b.proposal != nil && !b.extends(b.proposal):
+		b.proposal = nil
+	}
+}
+
+// startHeight resets the rounds for a new height; callers must hold b.mu
+func (b *BFT) startHeight(height uint64, validators *ValidatorSet) {
+	b.height = height
+	b.round = 0
+	b.step = StepPropose
+	b.roundStart = time.Now()
+	b.validators = validators
+	b.proposal = nil
+	b.locked = ""
+	b.lockRound = 0
+	b.prevotes = make(map[uint32]*voteSet)
+	b.precommits = make(map[uint32]*voteSet)
+}
+
+// replayFuture counts held votes for the current height and drops those
+// for heights already passed; callers must hold b.mu
+func (b *BFT) replayFuture() ([]*blockchain.Vote, *blockchain.Commit) {
+	held := b.future
+	b.future = make(map[string][]*blockchain.Vote)
+	for validator, votes := range held {
+		for _, vote := range votes {
+			switch {
+			case vote.Height > b.height:
+				b.future[validator] = append(b.future[validator], vote)
+			case vote.Height == b.height:
+				b.count(vote)
+			}
+		}
+	}
+	return b.progress()
+}
+
+// count verifies a vote for the current height and adds it to its round's
+// tally; callers must hold b.mu
+func (b *BFT) count(vote *blockchain.Vote) error {
+	validator, err := b.verify(vote)
+	if err != nil {
+		return err
+	}
+
+	var tallies map[uint32]*voteSet
+	switch vote.Type {
+	case blockchain.VotePrevote:
+		tallies = b.prevotes
+	case blockchain.VotePrecommit:
+		tallies = b.precommits
+	default:
+		return fmt.Errorf("unknown vote type %d", vote.Type)
+	}
+	if tallies[vote.Round] == nil {
+		tallies[vote.Round] = newVoteSet()
+	}
+	return tallies[vote.Round].add(vote, validator.Power())
+}
+
+// verify checks that a vote is signed by a validator of the current set
+// and returns that validator; callers must hold b.mu
+func (b *BFT) verify(vote *blockchain.Vote) (*Validator, error) {
+	validator, err := b.validators.GetValidator(vote.Validator)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a validator", vote.Validator)
+	}
+	if err := vote.Verify(crypto.PublicKeyToHex(validator.PublicKey)); err != nil {
+		return nil, err
+	}
+	return validator, nil
+}
+
+// progress precommits once the current round's prevotes reach 2/3 and
+// returns a commit once any round's precommits do; callers must hold b.mu
+func (b *BFT) progress() ([]*blockchain.Vote, *blockchain.Commit) {
+	total := b.validators.TotalPower()
+
+	var cast []*blockchain.Vote
+
+	// Follow the other validators into a later round once 2/3 of them
+	// prevoted in it
+	next := b.round
+	for round, prevotes := range b.prevotes {
+		if _, ok := prevotes.majority(total); ok && round > next {
+			next = round
+		}
+	}
+	b.unlock(next, total)
+	if next > b.round {
+		b.round = next
+		b.step = StepPropose
+		b.roundStart = time.Now()
+		cast = append(cast, b.prevote()...)
+	}
+
+	if prevotes := b.prevotes[b.round]; prevotes != nil && b.step != StepPrecommit {
+		if hash, ok := prevotes.majority(total); ok && (hash == "" || b.knows(hash)) {
+			cast = append(cast, b.precommit(hash)...)
+		}
+	}
+
+	for round, precommits := range b.precommits {
+		if hash, ok := precommits.majority(total); ok && hash != "" {
+			b.step = StepCommit
+			b.committed = hash
+			b.committedAt = b.height
+			return cast, blockchain.NewCommit(b.height, round, hash, precommits.votesFor(hash))
+		}
+	}
+	return cast, nil
+}
+
+// unlock releases this node's lock once more than 2/3 prevoted for another
+// block or for nil in a round after the lock round, up to round. Those
+// validators will not precommit the locked block in that round, so holding
+// on to it could only stall the height; callers must hold b.mu
+func (b *BFT) unlock(round uint32, total uint64) {
+	if b.locked == "" {
+		return
+	}
+	for r, prevotes := range b.prevotes {
+		if r <= b.lockRound || r > round {
+			continue
+		}
+		if hash, ok := prevotes.majority(total); ok && hash != b.locked {
+			b.locked = ""
+			return
+		}
+	}
+}
+
+// extends reports whether block descends from the last committed block;
+// callers must hold b.mu
+func (b *BFT) extends(block *blockchain.Block) bool {
+	return b.committed == "" || b.Chain.Extends(block.Hash, b.committed)
+}
+
+// knows reports whether this node has the block it would precommit;
+// callers must hold b.mu
+func (b *BFT) knows(blockHash string) bool {
+	return blockHash == b.locked || (b.proposal != nil && b.proposal.Hash == blockHash)
+}
+
+// prevote casts this node's prevote for the current round: for the block
+// it is locked on, otherwise for the proposal, or for nil without one;
+// callers must hold b.mu
+func (b *BFT) prevote() []*blockchain.Vote {
+	hash := b.locked
+	if hash == "" && b.proposal != nil {
+		hash = b.proposal.Hash
+	}
+	b.step = StepPrevote
+	return b.cast(blockchain.VotePrevote, hash)
+}
+
+// precommit casts this node's precommit for a block, or for nil, and locks
+// on the block in the current round; callers must hold b.mu
+func (b *BFT) precommit(blockHash string) []*blockchain.Vote {
+	b.step = StepPrecommit
+	if blockHash != "" {
+		b.locked = blockHash
+		b.lockRound = b.round
+	}
+	return b.cast(blockchain.VotePrecommit, blockHash)
+}
+
+// cast signs and counts this node's vote, if it is a validator at the
+// current height; callers must hold b.mu
+func (b *BFT) cast(voteType blockchain.VoteType, blockHash string) []*blockchain.Vote {
+	if b.signer == nil {
+		return nil
+	}
+	if _, err := b.validators.GetValidator(b.signer.Address); err != nil {
+		return nil
+	}
+
+	vote := blockchain.NewVote(b.ChainID, voteType, b.height, b.round, blockHash, b.signer.Address)
+	if err := vote.Sign(b.signer.PrivateKey); err != nil {
+		return nil
+	}
+	if err := b.count(vote); err != nil {
+		return nil
+	}
+	return []*blockchain.Vote{vote}
+}
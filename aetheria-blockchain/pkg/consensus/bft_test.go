@@ -0,0 +1,285 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aetheria/blockchain/pkg/blockchain"
+	"github.com/aetheria/blockchain/pkg/crypto"
+)
+
+const bftTestChain = "bft-test"
+
+// bftTree is a BlockTree over blocks linked by PrevHash
+type bftTree map[string]*blockchain.Block
+
+func (tree bftTree) Extends(hash, ancestor string) bool {
+	for block := tree[hash]; block != nil; block = tree[block.PrevHash] {
+		if block.Hash == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a block at height on top of parent
+func (tree bftTree) add(hash, parent string, height uint64) *blockchain.Block {
+	block := &blockchain.Block{Index: height, Hash: hash, PrevHash: parent}
+	tree[hash] = block
+	return block
+}
+
+// bftNetwork is four equal validators, the first of them run by engine
+type bftNetwork struct {
+	t          *testing.T
+	keys       []*crypto.KeyPair
+	validators *ValidatorSet
+	tree       bftTree
+	engine     *BFT
+}
+
+func newBFTNetwork(t *testing.T) *bftNetwork {
+	net := &bftNetwork{t: t, validators: NewValidatorSet(), tree: make(bftTree)}
+	for i := 0; i < 4; i++ {
+		keyPair, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		net.keys = append(net.keys, keyPair)
+		if err := net.validators.AddValidator(ValidatorFromKeyPair(keyPair, 1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	net.engine = NewBFT(bftTestChain, time.Millisecond, net.tree)
+	net.engine.SetSigner(ValidatorFromKeyPair(net.keys[0], 1000))
+	return net
+}
+
+// vote delivers votes from the other validators to the engine and returns
+// what it cast in response and the commit, if one formed
+func (net *bftNetwork) vote(voteType blockchain.VoteType, height uint64, round uint32, hash string, from ...int) ([]*blockchain.Vote, *blockchain.Commit) {
+	var cast []*blockchain.Vote
+	var commit *blockchain.Commit
+	for _, i := range from {
+		vote := blockchain.NewVote(bftTestChain, voteType, height, round, hash, net.keys[i].Address())
+		if err := vote.Sign(net.keys[i].PrivateKey); err != nil {
+			net.t.Fatal(err)
+		}
+		votes, c, err := net.engine.AddVote(vote)
+		if err != nil {
+			net.t.Fatalf("vote by validator %d: %v", i, err)
+		}
+		cast = append(cast, votes...)
+		if c != nil {
+			commit = c
+		}
+	}
+	return cast, commit
+}
+
+// timeout starts the engine's next round with proposal
+func (net *bftNetwork) timeout(proposal *blockchain.Block) []*blockchain.Vote {
+	time.Sleep(2 * net.engine.RoundTimeout)
+	return net.engine.Timeout(time.Now(), proposal)
+}
+
+// commit finalizes block at its height through the engine
+func (net *bftNetwork) commit(block *blockchain.Block) {
+	net.engine.Propose(block, net.validators)
+	net.vote(blockchain.VotePrevote, block.Index, 0, block.Hash, 1, 2)
+	if _, commit := net.vote(blockchain.VotePrecommit, block.Index, 0, block.Hash, 1, 2); commit == nil {
+		net.t.Fatalf("block %s did not commit", block.Hash)
+	}
+}
+
+// expectVote checks that votes is a single vote of voteType for hash
+func expectVote(t *testing.T, votes []*blockchain.Vote, voteType blockchain.VoteType, hash string) {
+	t.Helper()
+	if len(votes) != 1 || votes[0].Type != voteType || votes[0].BlockHash != hash {
+		t.Fatalf("expected a %s for %q, got %v", voteType, hash, votes)
+	}
+}
+
+func TestBFTCommitsWithTwoThirds(t *testing.T) {
+	net := newBFTNetwork(t)
+	block := net.tree.add("a", "genesis", 1)
+
+	votes, _ := net.engine.Propose(block, net.validators)
+	expectVote(t, votes, blockchain.VotePrevote, "a")
+	votes, _ = net.vote(blockchain.VotePrevote, 1, 0, "a", 1, 2)
+	expectVote(t, votes, blockchain.VotePrecommit, "a")
+
+	_, commit := net.vote(blockchain.VotePrecommit, 1, 0, "a", 1, 2)
+	if commit == nil || commit.BlockHash != "a" || len(commit.Precommits) != 3 {
+		t.Fatalf("expected a commit for a with 3 precommits, got %+v", commit)
+	}
+	if _, _, step := net.engine.Status(); step != StepCommit {
+		t.Fatalf("expected step %d, got %d", StepCommit, step)
+	}
+}
+
+func TestBFTPrevotesLockedBlock(t *testing.T) {
+	net := newBFTNetwork(t)
+	a := net.tree.add("a", "genesis", 1)
+	b := net.tree.add("b", "genesis", 1)
+
+	net.engine.Propose(a, net.validators)
+	votes, _ := net.vote(blockchain.VotePrevote, 1, 0, "a", 1, 2)
+	expectVote(t, votes, blockchain.VotePrecommit, "a")
+
+	// A new round proposing another block does not move a locked validator
+	expectVote(t, net.timeout(b), blockchain.VotePrevote, "a")
+	expectVote(t, net.timeout(nil), blockchain.VotePrevote, "a")
+}
+
+func TestBFTUnlocksOnLaterPolka(t *testing.T) {
+	net := newBFTNetwork(t)
+	a := net.tree.add("a", "genesis", 1)
+	b := net.tree.add("b", "genesis", 1)
+
+	net.engine.Propose(a, net.validators)
+	net.vote(blockchain.VotePrevote, 1, 0, "a", 1, 2)
+
+	// A polka for nil in a later round releases the lock
+	expectVote(t, net.timeout(nil), blockchain.VotePrevote, "a")
+	votes, _ := net.vote(blockchain.VotePrevote, 1, 1, "", 1, 2, 3)
+	expectVote(t, votes, blockchain.VotePrecommit, "")
+	expectVote(t, net.timeout(b), blockchain.VotePrevote, "b")
+
+	// and so does a polka for another block, which this node then commits
+	votes, _ = net.vote(blockchain.VotePrevote, 1, 2, "b", 1, 2)
+	expectVote(t, votes, blockchain.VotePrecommit, "b")
+	if _, commit := net.vote(blockchain.VotePrecommit, 1, 2, "b", 1, 2); commit == nil || commit.BlockHash != "b" {
+		t.Fatalf("expected a commit for b, got %+v", commit)
+	}
+}
+
+func TestBFTIgnoresPolkaBeforeLockRound(t *testing.T) {
+	net := newBFTNetwork(t)
+	a := net.tree.add("a", "genesis", 1)
+	b := net.tree.add("b", "genesis", 1)
+
+	net.engine.Propose(a, net.validators)
+	net.vote(blockchain.VotePrevote, 1, 0, "b", 3)
+	net.timeout(a)
+	votes, _ := net.vote(blockchain.VotePrevote, 1, 1, "a", 1, 2)
+	expectVote(t, votes, blockchain.VotePrecommit, "a")
+
+	// Late prevotes completing a round-0 polka for b predate the round-1
+	// lock on a and must not release it
+	net.vote(blockchain.VotePrevote, 1, 0, "b", 1, 2)
+	expectVote(t, net.timeout(b), blockchain.VotePrevote, "a")
+}
+
+func TestBFTKeepsHeightUntilCommit(t *testing.T) {
+	net := newBFTNetwork(t)
+	a := net.tree.add("a", "genesis", 1)
+	other := net.tree.add("c", "genesis", 1)
+	child := net.tree.add("d", "c", 2)
+
+	net.engine.Propose(a, net.validators)
+	net.vote(blockchain.VotePrevote, 1, 0, "a", 1, 2)
+
+	// A higher block on a conflicting branch neither starts its height nor
+	// drops the lock on a
+	if votes, _ := net.engine.Propose(child, net.validators); len(votes) != 0 {
+		t.Fatalf("expected no votes for a block above an uncommitted height, got %v", votes)
+	}
+	if height, _, _ := net.engine.Status(); height != 1 {
+		t.Fatalf("expected height 1, got %d", height)
+	}
+	expectVote(t, net.timeout(other), blockchain.VotePrevote, "a")
+
+	// Once the height commits, the next one starts
+	if _, commit := net.vote(blockchain.VotePrecommit, 1, 0, "a", 1, 2); commit == nil {
+		t.Fatal("expected a commit for a")
+	}
+	next := net.tree.add("e", "a", 2)
+	votes, _ := net.engine.Propose(next, net.validators)
+	expectVote(t, votes, blockchain.VotePrevote, "e")
+}
+
+func TestBFTRefusesBlocksNotExtendingCommitted(t *testing.T) {
+	net := newBFTNetwork(t)
+	net.commit(net.tree.add("a", "genesis", 1))
+
+	conflicting := net.tree.add("x", "genesis", 2)
+	votes, _ := net.engine.Propose(conflicting, net.validators)
+	expectVote(t, votes, blockchain.VotePrevote, "")
+
+	extending := net.tree.add("b", "a", 2)
+	expectVote(t, net.timeout(extending), blockchain.VotePrevote, "b")
+}
+
+func TestBFTFinalizedEndsHeight(t *testing.T) {
+	net := newBFTNetwork(t)
+	a := net.tree.add("a", "genesis", 1)
+	b := net.tree.add("b", "a", 2)
+
+	net.engine.Propose(a, net.validators)
+	net.vote(blockchain.VotePrevote, 1, 0, "a", 1, 2)
+
+	// The chain finalized a block above the height through peers' commit
+	net.engine.Finalized(b)
+	if height, _, step := net.engine.Status(); height != 2 || step != StepCommit {
+		t.Fatalf("expected height 2 committed, got height %d step %d", height, step)
+	}
+
+	c := net.tree.add("c", "b", 3)
+	votes, _ := net.engine.Propose(c, net.validators)
+	expectVote(t, votes, blockchain.VotePrevote, "c")
+}
+
+func TestBFTHoldsVerifiedFutureVotes(t *testing.T) {
+	net := newBFTNetwork(t)
+	a := net.tree.add("a", "genesis", 1)
+	net.engine.Propose(a, net.validators)
+
+	net.vote(blockchain.VotePrevote, 2, 0, "b", 1, 2)
+
+	stranger, err := crypto.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vote := blockchain.NewVote(bftTestChain, blockchain.VotePrevote, 2, 0, "b", stranger.Address())
+	vote.Sign(stranger.PrivateKey)
+	if _, _, err := net.engine.AddVote(vote); err == nil {
+		t.Fatal("expected a future vote by a non-validator to be rejected")
+	}
+	forged := blockchain.NewVote(bftTestChain, blockchain.VotePrevote, 2, 0, "b", net.keys[3].Address())
+	forged.Sign(stranger.PrivateKey)
+	if _, _, err := net.engine.AddVote(forged); err == nil {
+		t.Fatal("expected a future vote with a bad signature to be rejected")
+	}
+	far := blockchain.NewVote(bftTestChain, blockchain.VotePrevote, 2+futureHeights, 0, "b", net.keys[3].Address())
+	far.Sign(net.keys[3].PrivateKey)
+	if _, _, err := net.engine.AddVote(far); err == nil {
+		t.Fatal("expected a vote too far above the height to be rejected")
+	}
+
+	// The held prevotes complete a polka as soon as height 2 starts
+	net.vote(blockchain.VotePrevote, 1, 0, "a", 1, 2)
+	net.vote(blockchain.VotePrecommit, 1, 0, "a", 1, 2)
+	b := net.tree.add("b", "a", 2)
+	votes, _ := net.engine.Propose(b, net.validators)
+	if len(votes) != 2 || votes[0].Type != blockchain.VotePrevote || votes[1].Type != blockchain.VotePrecommit || votes[1].BlockHash != "b" {
+		t.Fatalf("expected a prevote and a precommit for b, got %v", votes)
+	}
+}
+
+func TestBFTCapsFutureVotesPerValidator(t *testing.T) {
+	net := newBFTNetwork(t)
+	net.engine.Propose(net.tree.add("a", "genesis", 1), net.validators)
+
+	for round := uint32(0); round < maxFutureVotes; round++ {
+		net.vote(blockchain.VotePrevote, 2, round, "b", 1)
+	}
+	vote := blockchain.NewVote(bftTestChain, blockchain.VotePrevote, 2, maxFutureVotes, "b", net.keys[1].Address())
+	vote.Sign(net.keys[1].PrivateKey)
+	if _, _, err := net.engine.AddVote(vote); err == nil {
+		t.Fatal("expected a validator's future votes to be capped")
+	}
+
+	// Other validators still have room
+	net.vote(blockchain.VotePrevote, 2, 0, "b", 2)
+}
@@ -1,105 +1,58 @@
 package consensus
 
 import (
-	"crypto/sha256"
-	"encoding/binary"
 	"fmt"
-	"math/big"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/aetheria/blockchain/pkg/blockchain"
+	"github.com/aetheria/blockchain/pkg/monetary"
 )
 
 // PoS implements Proof of Stake consensus
 type PoS struct {
-	ValidatorSet *ValidatorSet
-	MinStake     uint64
-	BlockTime    time.Duration
+	MinStake   uint64
+	BlockTime  time.Duration
+	Monetary   monetary.Policy // decides block rewards
+	validators *ValidatorSet   // active set of the head epoch
+	mu         sync.RWMutex
 }
 
-// NewPoS creates a new PoS consensus engine
-func NewPoS(minStake uint64, blockTime time.Duration) *PoS {
+// NewPoS creates a new PoS consensus engine minting block rewards under
+// policy
+func NewPoS(minStake uint64, blockTime time.Duration, policy monetary.Policy) *PoS {
 	return &PoS{
-		ValidatorSet: NewValidatorSet(),
-		MinStake:     minStake,
-		BlockTime:    blockTime,
+		MinStake:   minStake,
+		BlockTime:  blockTime,
+		Monetary:   policy,
+		validators: NewValidatorSet(),
 	}
 }
 
-// SelectValidator selects a validator based on stake weight
-// Uses weighted random selection where probability is proportional to stake
-func (pos *PoS) SelectValidator(prevBlockHash string, timestamp int64) (*Validator, error) {
-	validators := pos.ValidatorSet.GetValidators()
-	if len(validators) == 0 {
-		return nil, fmt.Errorf("no validators available")
-	}
-
-	// Filter validators with minimum stake
-	eligibleValidators := make([]*Validator, 0)
-	for _, v := range validators {
-		if v.CanValidate(pos.MinStake) {
-			eligibleValidators = append(eligibleValidators, v)
-		}
-	}
-
-	if len(eligibleValidators) == 0 {
-		return nil, fmt.Errorf("no eligible validators")
-	}
-
-	// Calculate total stake
-	var totalStake uint64
-	for _, v := range eligibleValidators {
-		totalStake += v.Stake
+// SelectValidator returns the validator elected to lead a slot on top of
+// state, the post-state of the block the slot's block would extend. The
+// election is weighted by voting power and seeded by the chain's RANDAO
+// beacon rather than by anything the previous proposer chooses; see
+// blockchain.State.SlotLeader.
+func (pos *PoS) SelectValidator(state *blockchain.State, slot uint64) (*Validator, error) {
+	leader, err := state.SlotLeader(slot)
+	if err != nil {
+		return nil, err
 	}
 
-	// Generate deterministic random number based on previous block hash and timestamp
-	seed := pos.generateSeed(prevBlockHash, timestamp)
-	
-	// Select validator using weighted random selection
-	target := new(big.Int).Mod(seed, big.NewInt(int64(totalStake)))
-	
-	var cumulative uint64
-	for _, v := range eligibleValidators {
-		cumulative += v.Stake
-		if target.Cmp(big.NewInt(int64(cumulative))) < 0 {
-			return v, nil
-		}
+	validator, err := pos.Validators().GetValidator(leader)
+	if err != nil {
+		return nil, fmt.Errorf("slot leader %s: %w", leader, err)
 	}
-
-	// Fallback to last validator (should not happen)
-	return eligibleValidators[len(eligibleValidators)-1], nil
+	return validator, nil
 }
 
-// generateSeed generates a deterministic seed for validator selection
-func (pos *PoS) generateSeed(prevBlockHash string, timestamp int64) *big.Int {
-	data := []byte(prevBlockHash)
-	timeBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(timeBytes, uint64(timestamp))
-	data = append(data, timeBytes...)
-	
-	hash := sha256.Sum256(data)
-	seed := new(big.Int).SetBytes(hash[:])
-	return seed
-}
-
-// ValidateBlock validates a block according to PoS rules
+// ValidateBlock applies the local checks on a received block that depend on
+// the node's clock. That the block's validator was elected for its slot and
+// signed it is checked by the chain, against the block's parent state, which
+// stays right on side branches and across epoch boundaries.
 func (pos *PoS) ValidateBlock(block *blockchain.Block, prevBlock *blockchain.Block) error {
-	// Check if validator exists and has minimum stake
-	validator, err := pos.ValidatorSet.GetValidator(block.Validator)
-	if err != nil {
-		return fmt.Errorf("validator not found: %w", err)
-	}
-
-	if !validator.CanValidate(pos.MinStake) {
-		return fmt.Errorf("validator does not have minimum stake")
-	}
-
-	// Verify block signature
-	if err := block.Verify(validator.PublicKey); err != nil {
-		return fmt.Errorf("invalid block signature: %w", err)
-	}
-
 	// Check block time (should not be too far in the future)
 	now := time.Now().Unix()
 	if block.Timestamp > now+int64(pos.BlockTime.Seconds()) {
@@ -114,33 +67,32 @@ func (pos *PoS) ValidateBlock(block *blockchain.Block, prevBlock *blockchain.Blo
 	return nil
 }
 
-// CalculateReward calculates the block reward for a validator
-func (pos *PoS) CalculateReward(block *blockchain.Block) uint64 {
-	// Base reward
-	reward := blockchain.BlockReward
-	
-	// Add transaction fees
-	reward += block.TotalFees()
-	
-	return reward
+// CalculateReward returns the amount the coinbase of the block at height
+// must mint for its validator, given the supply before the block.
+// Transaction fees, less the burned share, are paid to the validator on top
+// of it. PoS is the chain's blockchain.RewardSchedule.
+func (pos *PoS) CalculateReward(height uint64, supply monetary.Supply) uint64 {
+	return pos.Monetary.CalculateReward(height, supply)
 }
 
-// RegisterValidator registers a new validator
-func (pos *PoS) RegisterValidator(validator *Validator) error {
-	if validator.Stake < pos.MinStake {
-		return fmt.Errorf("stake %d is below minimum %d", validator.Stake, pos.MinStake)
-	}
-	return pos.ValidatorSet.AddValidator(validator)
+// Validators returns the validator set last synced from the chain. A sync
+// replaces the set rather than modifying it, so callers may keep using the
+// result.
+func (pos *PoS) Validators() *ValidatorSet {
+	pos.mu.RLock()
+	defer pos.mu.RUnlock()
+	return pos.validators
 }
 
-// UnregisterValidator removes a validator
-func (pos *PoS) UnregisterValidator(address string) error {
-	return pos.ValidatorSet.RemoveValidator(address)
-}
+// SyncValidators replaces the validator set with the active set of the
+// epoch state is in. The chain is the only source of validators: the set
+// changes when a block starts an epoch, never locally.
+func (pos *PoS) SyncValidators(state *blockchain.State) {
+	validators := ValidatorSetFromState(state)
 
-// UpdateValidatorStake updates a validator's stake
-func (pos *PoS) UpdateValidatorStake(address string, stake uint64) error {
-	return pos.ValidatorSet.UpdateStake(address, stake)
+	pos.mu.Lock()
+	defer pos.mu.Unlock()
+	pos.validators = validators
 }
 
 // GetNextBlockTime returns the time when the next block should be created
@@ -156,7 +108,7 @@ func (pos *PoS) ShouldCreateBlock(lastBlockTime int64) bool {
 
 // SelectValidatorSimple selects a random validator (for testing/simple scenarios)
 func (pos *PoS) SelectValidatorSimple() (*Validator, error) {
-	validators := pos.ValidatorSet.GetValidators()
+	validators := pos.Validators().GetValidators()
 	if len(validators) == 0 {
 		return nil, fmt.Errorf("no validators available")
 	}
@@ -4,6 +4,7 @@ import (
 	"crypto/ed25519"
 	"fmt"
 
+	"github.com/aetheria/blockchain/pkg/blockchain"
 	"github.com/aetheria/blockchain/pkg/crypto"
 )
 
@@ -12,7 +13,9 @@ type Validator struct {
 	Address    string
 	PublicKey  ed25519.PublicKey
 	PrivateKey ed25519.PrivateKey
-	Stake      uint64
+	Stake      uint64 // the validator's own bonded stake
+	Delegated  uint64 // stake delegated to the validator by other addresses
+	Commission uint64 // share of rewards kept before paying delegators, in basis points
 }
 
 // NewValidator creates a new validator
@@ -37,28 +40,37 @@ func ValidatorFromKeyPair(keyPair *crypto.KeyPair, stake uint64) *Validator {
 
 // ValidatorInfo represents public validator information
 type ValidatorInfo struct {
-	Address   string `json:"address"`
-	PublicKey string `json:"public_key"`
-	Stake     uint64 `json:"stake"`
-	Weight    float64 `json:"weight"`
+	Address    string  `json:"address"`
+	PublicKey  string  `json:"public_key"`
+	Stake      uint64  `json:"stake"`
+	Delegated  uint64  `json:"delegated"`
+	Commission uint64  `json:"commission"`
+	Weight     float64 `json:"weight"`
+}
+
+// Power returns the validator's voting power: its own and delegated stake
+func (v *Validator) Power() uint64 {
+	return v.Stake + v.Delegated
 }
 
 // GetInfo returns public validator information
-func (v *Validator) GetInfo(totalStake uint64) *ValidatorInfo {
+func (v *Validator) GetInfo(totalPower uint64) *ValidatorInfo {
 	weight := 0.0
-	if totalStake > 0 {
-		weight = float64(v.Stake) / float64(totalStake)
+	if totalPower > 0 {
+		weight = float64(v.Power()) / float64(totalPower)
 	}
 
 	return &ValidatorInfo{
-		Address:   v.Address,
-		PublicKey: crypto.PublicKeyToHex(v.PublicKey),
-		Stake:     v.Stake,
-		Weight:    weight,
+		Address:    v.Address,
+		PublicKey:  crypto.PublicKeyToHex(v.PublicKey),
+		Stake:      v.Stake,
+		Delegated:  v.Delegated,
+		Commission: v.Commission,
+		Weight:     weight,
 	}
 }
 
-// CanValidate checks if validator has minimum stake
+// CanValidate checks if validator has minimum stake of its own
 func (v *Validator) CanValidate(minStake uint64) bool {
 	return v.Stake >= minStake
 }
@@ -75,6 +87,27 @@ func NewValidatorSet() *ValidatorSet {
 	}
 }
 
+// ValidatorSetFromState builds a validator set from the active set of the
+// epoch state is in, with each validator's stake and delegations as frozen
+// at the epoch start and its current commission rate
+func ValidatorSetFromState(state *blockchain.State) *ValidatorSet {
+	vs := NewValidatorSet()
+	for _, v := range state.ActiveValidators() {
+		publicKey, err := crypto.PublicKeyFromHex(v.PublicKey)
+		if err != nil {
+			continue
+		}
+		vs.Validators[v.Address] = &Validator{
+			Address:    v.Address,
+			PublicKey:  publicKey,
+			Stake:      v.Stake,
+			Delegated:  v.Delegated,
+			Commission: state.GetCommission(v.Address),
+		}
+	}
+	return vs
+}
+
 // AddValidator adds a validator to the set
 func (vs *ValidatorSet) AddValidator(validator *Validator) error {
 	if _, exists := vs.Validators[validator.Address]; exists {
@@ -121,6 +154,15 @@ func (vs *ValidatorSet) TotalStake() uint64 {
 	return total
 }
 
+// TotalPower returns the total voting power of all validators
+func (vs *ValidatorSet) TotalPower() uint64 {
+	var total uint64
+	for _, validator := range vs.Validators {
+		total += validator.Power()
+	}
+	return total
+}
+
 // GetValidators returns all validators
 func (vs *ValidatorSet) GetValidators() []*Validator {
 	validators := make([]*Validator, 0, len(vs.Validators))
@@ -132,10 +174,10 @@ func (vs *ValidatorSet) GetValidators() []*Validator {
 
 // GetValidatorInfos returns public information for all validators
 func (vs *ValidatorSet) GetValidatorInfos() []*ValidatorInfo {
-	totalStake := vs.TotalStake()
+	totalPower := vs.TotalPower()
 	infos := make([]*ValidatorInfo, 0, len(vs.Validators))
 	for _, validator := range vs.Validators {
-		infos = append(infos, validator.GetInfo(totalStake))
+		infos = append(infos, validator.GetInfo(totalPower))
 	}
 	return infos
 }
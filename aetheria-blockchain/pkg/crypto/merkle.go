@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Domain separation prefixes keep leaf hashes and interior node hashes
+// from ever colliding (RFC 6962 style)
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleProofStep is one sibling hash on the path from a leaf to the root
+type MerkleProofStep struct {
+	Hash string `json:"hash"` // hex-encoded sibling hash
+	Left bool   `json:"left"` // true if the sibling is the left child
+}
+
+// MerkleLeafHash hashes a leaf value
+func MerkleLeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// merkleNodeHash hashes two child hashes into their parent
+func merkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleLevels builds every level of the tree, leaves first. An odd node at
+// the end of a level is carried up unchanged rather than duplicated.
+func merkleLevels(leaves [][]byte) [][][]byte {
+	level := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = MerkleLeafHash(leaf)
+	}
+
+	levels := [][][]byte{level}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNodeHash(level[i], level[i+1]))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// MerkleRoot computes the root of a binary Merkle tree over leaves. The root
+// of an empty tree is the hash of no data.
+func MerkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		return Hash(nil)
+	}
+	levels := merkleLevels(leaves)
+	return levels[len(levels)-1][0]
+}
+
+// MerkleProof returns the sibling path proving leaves[index] is in the tree
+func MerkleProof(leaves [][]byte, index int) ([]MerkleProofStep, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf index %d out of range", index)
+	}
+
+	levels := merkleLevels(leaves)
+	proof := make([]MerkleProofStep, 0, len(levels)-1)
+	for _, level := range levels[:len(levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, MerkleProofStep{
+				Hash: hex.EncodeToString(level[sibling]),
+				Left: sibling < index,
+			})
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyMerkleProof checks that leaf is included in the tree with the given root
+func VerifyMerkleProof(root []byte, leaf []byte, proof []MerkleProofStep) bool {
+	current := MerkleLeafHash(leaf)
+	for _, step := range proof {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil || len(sibling) != sha256.Size {
+			return false
+		}
+		if step.Left {
+			current = merkleNodeHash(sibling, current)
+		} else {
+			current = merkleNodeHash(current, sibling)
+		}
+	}
+	return bytes.Equal(current, root)
+}
@@ -0,0 +1,294 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// smtDepth is the number of levels in the sparse Merkle tree: one per bit
+// of the SHA-256 key path
+const smtDepth = 256
+
+// emptyHash is the hash of an empty subtree at any level
+var emptyHash = make([]byte, sha256.Size)
+
+// SparseMerkleTree is an authenticated map from keys to values. Keys are
+// hashed to 256-bit paths; empty subtrees hash to all zeros, so only the
+// populated branches need to be computed. A subtree holding a single key is
+// stored as one leaf node, and nodes are never changed once built: an update
+// rehashes the path to its key, and a copy shares every node with the tree
+// it was taken from.
+type SparseMerkleTree struct {
+	root *smtNode
+}
+
+// smtNode is a non-empty subtree: a leaf node when it holds a single key,
+// otherwise a branch
+type smtNode struct {
+	left, right *smtNode          // children of a branch; nil when empty
+	path        [sha256.Size]byte // key path of a leaf node
+	leaf        []byte            // leaf hash of a leaf node; nil for a branch
+	hash        []byte            // root of the subtree
+}
+
+// SparseMerkleProof proves the value (or absence) of a key. Only non-empty
+// sibling hashes are listed; Bitmap marks which levels they belong to,
+// starting from the root.
+type SparseMerkleProof struct {
+	Bitmap   string   `json:"bitmap"`
+	Siblings []string `json:"siblings"`
+}
+
+// NewSparseMerkleTree creates an empty tree
+func NewSparseMerkleTree() *SparseMerkleTree {
+	return &SparseMerkleTree{}
+}
+
+// Copy returns a tree with the same contents as t. Updating either tree
+// leaves the other unchanged.
+func (t *SparseMerkleTree) Copy() *SparseMerkleTree {
+	return &SparseMerkleTree{root: t.root}
+}
+
+// smtPath returns the tree path for a key
+func smtPath(key []byte) [sha256.Size]byte {
+	return sha256.Sum256(key)
+}
+
+// smtLeafHash hashes a populated leaf, binding it to its path
+func smtLeafHash(path [sha256.Size]byte, value []byte) []byte {
+	valueHash := sha256.Sum256(value)
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(path[:])
+	h.Write(valueHash[:])
+	return h.Sum(nil)
+}
+
+// smtNodeHash hashes two children, collapsing empty pairs to the empty hash
+func smtNodeHash(left, right []byte) []byte {
+	if bytes.Equal(left, emptyHash) && bytes.Equal(right, emptyHash) {
+		return emptyHash
+	}
+	return merkleNodeHash(left, right)
+}
+
+// smtParentHash hashes the node at depth from its child on path and that
+// child's sibling
+func smtParentHash(path [sha256.Size]byte, depth int, child, sibling []byte) []byte {
+	if bitAt(path, depth) == 0 {
+		return smtNodeHash(child, sibling)
+	}
+	return smtNodeHash(sibling, child)
+}
+
+// smtSoloHash returns the root of the subtree at depth holding only the
+// leaf at path
+func smtSoloHash(path [sha256.Size]byte, leaf []byte, depth int) []byte {
+	hash := leaf
+	for d := smtDepth - 1; d >= depth; d-- {
+		hash = smtParentHash(path, d, hash, emptyHash)
+	}
+	return hash
+}
+
+// smtHash returns the root of a subtree
+func smtHash(n *smtNode) []byte {
+	if n == nil {
+		return emptyHash
+	}
+	return n.hash
+}
+
+// bitAt returns the bit of path at the given depth (0 = most significant)
+func bitAt(path [sha256.Size]byte, depth int) byte {
+	return (path[depth/8] >> (7 - uint(depth%8))) & 1
+}
+
+// smtSplitDepth returns the first depth at which two different paths part
+func smtSplitDepth(a, b [sha256.Size]byte, depth int) int {
+	for bitAt(a, depth) == bitAt(b, depth) {
+		depth++
+	}
+	return depth
+}
+
+// newSMTLeaf returns the leaf node at depth for a key alone in its subtree
+func newSMTLeaf(path [sha256.Size]byte, leaf []byte, depth int) *smtNode {
+	return &smtNode{path: path, leaf: leaf, hash: smtSoloHash(path, leaf, depth)}
+}
+
+// newSMTBranch returns the node at depth with the given children. A leaf
+// node without a sibling is pulled up in place of the branch.
+func newSMTBranch(depth int, left, right *smtNode) *smtNode {
+	switch {
+	case left == nil && right == nil:
+		return nil
+	case left == nil && right.leaf != nil:
+		return liftSMTLeaf(right, depth)
+	case right == nil && left.leaf != nil:
+		return liftSMTLeaf(left, depth)
+	}
+	return &smtNode{left: left, right: right, hash: smtNodeHash(smtHash(left), smtHash(right))}
+}
+
+// liftSMTLeaf returns the leaf node at depth holding the same key as a leaf
+// node one level below it
+func liftSMTLeaf(n *smtNode, depth int) *smtNode {
+	return &smtNode{path: n.path, leaf: n.leaf, hash: smtParentHash(n.path, depth, n.hash, emptyHash)}
+}
+
+// smtUpdate returns the subtree at depth rooted at n with the leaf at path
+// set to leaf, or removed when leaf is nil
+func smtUpdate(n *smtNode, depth int, path [sha256.Size]byte, leaf []byte) *smtNode {
+	if n == nil {
+		if leaf == nil {
+			return nil
+		}
+		return newSMTLeaf(path, leaf, depth)
+	}
+
+	if n.leaf != nil {
+		switch {
+		case n.path == path && leaf == nil:
+			return nil
+		case n.path == path && bytes.Equal(n.leaf, leaf):
+			return n
+		case n.path == path:
+			return newSMTLeaf(path, leaf, depth)
+		case leaf == nil:
+			return n
+		}
+
+		// Both keys now share the subtree: branch where their paths part
+		split := smtSplitDepth(n.path, path, depth)
+		existing := newSMTLeaf(n.path, n.leaf, split+1)
+		added := newSMTLeaf(path, leaf, split+1)
+		node := &smtNode{left: added, right: existing}
+		if bitAt(path, split) == 1 {
+			node = &smtNode{left: existing, right: added}
+		}
+		node.hash = smtNodeHash(node.left.hash, node.right.hash)
+		for d := split - 1; d >= depth; d-- {
+			child := node
+			node = &smtNode{left: child}
+			if bitAt(path, d) == 1 {
+				node = &smtNode{right: child}
+			}
+			node.hash = smtParentHash(path, d, child.hash, emptyHash)
+		}
+		return node
+	}
+
+	left, right := n.left, n.right
+	if bitAt(path, depth) == 0 {
+		left = smtUpdate(left, depth+1, path, leaf)
+	} else {
+		right = smtUpdate(right, depth+1, path, leaf)
+	}
+	return newSMTBranch(depth, left, right)
+}
+
+// Update sets the value for key. A nil value removes the key.
+func (t *SparseMerkleTree) Update(key []byte, value []byte) {
+	path := smtPath(key)
+	var leaf []byte
+	if value != nil {
+		leaf = smtLeafHash(path, value)
+	}
+	t.root = smtUpdate(t.root, 0, path, leaf)
+}
+
+// Root returns the tree root
+func (t *SparseMerkleTree) Root() []byte {
+	return smtHash(t.root)
+}
+
+// Prove returns a proof for key, valid whether or not the key is present
+func (t *SparseMerkleTree) Prove(key []byte) *SparseMerkleProof {
+	target := smtPath(key)
+	bitmap := make([]byte, smtDepth/8)
+	siblings := make([]string, 0)
+	addSibling := func(depth int, hash []byte) {
+		bitmap[depth/8] |= 1 << (7 - uint(depth%8))
+		siblings = append(siblings, hex.EncodeToString(hash))
+	}
+
+	node := t.root
+	for depth := 0; node != nil && depth < smtDepth; depth++ {
+		if node.leaf != nil {
+			// Below a leaf node every subtree is empty, except for the
+			// leaf's own where its path parts from the target's
+			if node.path != target {
+				split := smtSplitDepth(node.path, target, depth)
+				addSibling(split, smtSoloHash(node.path, node.leaf, split+1))
+			}
+			break
+		}
+
+		child, sibling := node.left, node.right
+		if bitAt(target, depth) == 1 {
+			child, sibling = node.right, node.left
+		}
+		if sibling != nil {
+			addSibling(depth, sibling.hash)
+		}
+		node = child
+	}
+
+	return &SparseMerkleProof{
+		Bitmap:   hex.EncodeToString(bitmap),
+		Siblings: siblings,
+	}
+}
+
+// VerifySparseMerkleProof checks that key maps to value under root. A nil
+// value checks that the key is absent.
+func VerifySparseMerkleProof(root, key, value []byte, proof *SparseMerkleProof) error {
+	bitmap, err := hex.DecodeString(proof.Bitmap)
+	if err != nil || len(bitmap) != smtDepth/8 {
+		return fmt.Errorf("invalid proof bitmap")
+	}
+
+	// Expand the compressed sibling list, root level first
+	siblings := make([][]byte, smtDepth)
+	next := 0
+	for depth := 0; depth < smtDepth; depth++ {
+		if bitmap[depth/8]&(1<<(7-uint(depth%8))) == 0 {
+			siblings[depth] = emptyHash
+			continue
+		}
+		if next >= len(proof.Siblings) {
+			return fmt.Errorf("proof has too few siblings")
+		}
+		sibling, err := hex.DecodeString(proof.Siblings[next])
+		if err != nil || len(sibling) != sha256.Size {
+			return fmt.Errorf("invalid proof sibling")
+		}
+		siblings[depth] = sibling
+		next++
+	}
+	if next != len(proof.Siblings) {
+		return fmt.Errorf("proof has too many siblings")
+	}
+
+	path := smtPath(key)
+	current := emptyHash
+	if value != nil {
+		current = smtLeafHash(path, value)
+	}
+	for depth := smtDepth - 1; depth >= 0; depth-- {
+		if bitAt(path, depth) == 0 {
+			current = smtNodeHash(current, siblings[depth])
+		} else {
+			current = smtNodeHash(siblings[depth], current)
+		}
+	}
+
+	if !bytes.Equal(current, root) {
+		return fmt.Errorf("proof does not match root")
+	}
+	return nil
+}
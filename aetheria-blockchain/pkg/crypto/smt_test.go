@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// newTestTree builds a tree mapping key0..key(n-1) to value0..value(n-1)
+func newTestTree(n int) *SparseMerkleTree {
+	tree := NewSparseMerkleTree()
+	for i := 0; i < n; i++ {
+		tree.Update([]byte(fmt.Sprint("key", i)), []byte(fmt.Sprint("value", i)))
+	}
+	return tree
+}
+
+func TestSMTProvesMembershipAndAbsence(t *testing.T) {
+	tree := newTestTree(50)
+	root := tree.Root()
+
+	for i := 0; i < 50; i++ {
+		key, value := []byte(fmt.Sprint("key", i)), []byte(fmt.Sprint("value", i))
+		proof := tree.Prove(key)
+		if err := VerifySparseMerkleProof(root, key, value, proof); err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		if err := VerifySparseMerkleProof(root, key, []byte("other"), proof); err == nil {
+			t.Fatalf("%s: expected a proof of the wrong value to fail", key)
+		}
+		if err := VerifySparseMerkleProof(root, key, nil, proof); err == nil {
+			t.Fatalf("%s: expected a present key not to be proven absent", key)
+		}
+	}
+
+	for i := 50; i < 60; i++ {
+		key := []byte(fmt.Sprint("key", i))
+		proof := tree.Prove(key)
+		if err := VerifySparseMerkleProof(root, key, nil, proof); err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		if err := VerifySparseMerkleProof(root, key, []byte("value"), proof); err == nil {
+			t.Fatalf("%s: expected an absent key not to be proven present", key)
+		}
+	}
+}
+
+func TestSMTRejectsTamperedProof(t *testing.T) {
+	tree := newTestTree(20)
+	key, value := []byte("key3"), []byte("value3")
+	proof := tree.Prove(key)
+	if len(proof.Siblings) == 0 {
+		t.Fatal("expected a proof with siblings")
+	}
+
+	tampered := *proof
+	tampered.Siblings = append([]string(nil), proof.Siblings...)
+	tampered.Siblings[0] = fmt.Sprintf("%064x", 1)
+	if err := VerifySparseMerkleProof(tree.Root(), key, value, &tampered); err == nil {
+		t.Error("expected a proof with a changed sibling to fail")
+	}
+
+	short := *proof
+	short.Siblings = proof.Siblings[1:]
+	if err := VerifySparseMerkleProof(tree.Root(), key, value, &short); err == nil {
+		t.Error("expected a proof missing a sibling to fail")
+	}
+
+	if err := VerifySparseMerkleProof(newTestTree(21).Root(), key, value, proof); err == nil {
+		t.Error("expected a proof to fail against another root")
+	}
+}
+
+func TestSMTRootDependsOnlyOnContents(t *testing.T) {
+	forward := newTestTree(30)
+	backward := NewSparseMerkleTree()
+	for i := 39; i >= 0; i-- {
+		backward.Update([]byte(fmt.Sprint("key", i)), []byte(fmt.Sprint("value", i)))
+	}
+	for i := 30; i < 40; i++ {
+		backward.Update([]byte(fmt.Sprint("key", i)), nil)
+	}
+	if !bytes.Equal(forward.Root(), backward.Root()) {
+		t.Fatal("expected the same contents to give the same root in any order")
+	}
+
+	empty := newTestTree(1)
+	empty.Update([]byte("key0"), nil)
+	if !bytes.Equal(empty.Root(), emptyHash) {
+		t.Fatal("expected a tree with every key deleted to have the empty root")
+	}
+}
+
+func TestSMTCopyIsIndependent(t *testing.T) {
+	tree := newTestTree(10)
+	root := tree.Root()
+	copied := tree.Copy()
+
+	copied.Update([]byte("key1"), []byte("changed"))
+	copied.Update([]byte("key10"), []byte("value10"))
+	if !bytes.Equal(tree.Root(), root) {
+		t.Fatal("updating a copy changed the original")
+	}
+	want := newTestTree(11)
+	want.Update([]byte("key1"), []byte("changed"))
+	if !bytes.Equal(copied.Root(), want.Root()) {
+		t.Fatal("copy does not hold its updates")
+	}
+
+	tree.Update([]byte("key2"), nil)
+	if err := VerifySparseMerkleProof(copied.Root(), []byte("key2"), []byte("value2"), copied.Prove([]byte("key2"))); err != nil {
+		t.Fatalf("updating the original changed the copy: %v", err)
+	}
+}
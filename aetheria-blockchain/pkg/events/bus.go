@@ -0,0 +1,238 @@
+// Package events implements the publish/subscribe bus that the chain, the
+// mempool and the network use to notify other components of what happens
+// to them, so that nothing has to poll.
+//
+// Publishing never blocks: every subscription has its own buffer, and a
+// subscriber that falls behind is handled by its SlowConsumerPolicy instead
+// of stalling block processing.
+package events
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Topic identifies a kind of event
+type Topic uint8
+
+const (
+	// TopicNewBlock is published for every block joining the canonical chain
+	TopicNewBlock Topic = iota
+	// TopicReorg is published when the canonical chain switches branches
+	TopicReorg
+	// TopicTxAdded is published when a transaction enters the mempool
+	TopicTxAdded
+	// TopicTxEvicted is published when a transaction leaves the mempool
+	// without being mined
+	TopicTxEvicted
+	// TopicPeerConnected is published when a node adds a peer
+	TopicPeerConnected
+	// TopicPeerDisconnected is published when a node removes a peer
+	TopicPeerDisconnected
+	// TopicFinalized is published when a block becomes final
+	TopicFinalized
+)
+
+// topicNames maps topics to their names
+var topicNames = map[Topic]string{
+	TopicNewBlock:         "new_block",
+	TopicReorg:            "reorg",
+	TopicTxAdded:          "tx_added",
+	TopicTxEvicted:        "tx_evicted",
+	TopicPeerConnected:    "peer_connected",
+	TopicPeerDisconnected: "peer_disconnected",
+	TopicFinalized:        "finalized",
+}
+
+// String returns the name of the topic
+func (t Topic) String() string {
+	if name, ok := topicNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(t))
+}
+
+// ParseTopic returns the topic with the given name
+func ParseTopic(name string) (Topic, error) {
+	for topic, topicName := range topicNames {
+		if topicName == name {
+			return topic, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown event topic %q", name)
+}
+
+// Event is a notification published on a bus. Each topic has one concrete
+// event type, defined by the package that publishes it.
+type Event interface {
+	Topic() Topic
+}
+
+// SlowConsumerPolicy decides what happens when an event is published to a
+// subscription whose buffer is full
+type SlowConsumerPolicy uint8
+
+const (
+	// DropNewest discards the event being published
+	DropNewest SlowConsumerPolicy = iota
+	// DropOldest discards the oldest buffered event to make room
+	DropOldest
+	// Disconnect closes the subscription
+	Disconnect
+)
+
+// DefaultBuffer is the buffer size used for a subscription asking for none
+const DefaultBuffer = 64
+
+// Bus delivers published events to the subscriptions for their topic
+type Bus struct {
+	subscriptions map[*Subscription]struct{}
+	mu            sync.RWMutex
+}
+
+// NewBus creates a bus with no subscriptions
+func NewBus() *Bus {
+	return &Bus{subscriptions: make(map[*Subscription]struct{})}
+}
+
+// Subscribe returns a subscription receiving events on the given topics,
+// or on every topic if none are given. buffer is the number of events held
+// for the subscriber (0 means DefaultBuffer) and policy decides what
+// happens once it is full.
+func (b *Bus) Subscribe(buffer int, policy SlowConsumerPolicy, topics ...Topic) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	sub := &Subscription{
+		bus:    b,
+		policy: policy,
+		ch:     make(chan Event, buffer),
+	}
+	if len(topics) > 0 {
+		sub.topics = make(map[Topic]bool, len(topics))
+		for _, topic := range topics {
+			sub.topics[topic] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// Publish delivers an event to every subscription for its topic without
+// waiting for any subscriber. A nil bus discards the event.
+func (b *Bus) Publish(ev Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	var disconnected []*Subscription
+	for sub := range b.subscriptions {
+		if !sub.deliver(ev) {
+			disconnected = append(disconnected, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	if len(disconnected) > 0 {
+		b.mu.Lock()
+		for _, sub := range disconnected {
+			delete(b.subscriptions, sub)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Len returns the number of open subscriptions
+func (b *Bus) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subscriptions)
+}
+
+// Subscription is a subscriber's view of a bus
+type Subscription struct {
+	bus     *Bus
+	topics  map[Topic]bool // nil means every topic
+	policy  SlowConsumerPolicy
+	ch      chan Event
+	dropped uint64
+	closed  bool
+	mu      sync.Mutex
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription ends, by Unsubscribe or by the Disconnect policy.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns the number of events the subscription has lost to its
+// slow-consumer policy
+func (s *Subscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Unsubscribe ends the subscription and closes its channel
+func (s *Subscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	delete(s.bus.subscriptions, s)
+	s.bus.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.close()
+}
+
+// deliver buffers an event for the subscriber, applying the slow-consumer
+// policy when the buffer is full. It reports false once the subscription
+// has been closed.
+func (s *Subscription) deliver(ev Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if s.topics != nil && !s.topics[ev.Topic()] {
+		return true
+	}
+
+	select {
+	case s.ch <- ev:
+		return true
+	default:
+	}
+
+	s.dropped++
+	switch s.policy {
+	case DropOldest:
+		// The subscriber may drain the buffer concurrently, so neither
+		// step can be assumed to succeed
+		select {
+		case <-s.ch:
+		default:
+		}
+		select {
+		case s.ch <- ev:
+		default:
+		}
+	case Disconnect:
+		s.close()
+		return false
+	}
+	return true
+}
+
+// close closes the channel once; callers must hold s.mu
+func (s *Subscription) close() {
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
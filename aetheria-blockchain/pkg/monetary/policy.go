@@ -0,0 +1,171 @@
+package monetary
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// BasisPoints is the denominator for rates and shares
+const BasisPoints = 10000
+
+// Schedule names the rule deciding each block's reward
+type Schedule string
+
+const (
+	// Fixed mints BlockReward in every block
+	Fixed Schedule = "fixed"
+	// Halving mints BlockReward, halved every HalvingInterval blocks
+	Halving Schedule = "halving"
+	// Inflation mints a yearly share of the supply that rises as the staking
+	// ratio falls below TargetStakingRatio
+	Inflation Schedule = "inflation"
+)
+
+const (
+	// DefaultBlockReward is the default fixed block reward
+	DefaultBlockReward = 50
+	// DefaultHalvingInterval is the default number of blocks between halvings
+	DefaultHalvingInterval = 2100000
+	// DefaultInflationMin is the default yearly inflation at or above the
+	// target staking ratio, in basis points
+	DefaultInflationMin = 700
+	// DefaultInflationMax is the default yearly inflation with nothing
+	// staked, in basis points
+	DefaultInflationMax = 2000
+	// DefaultTargetStakingRatio is the default share of the supply the
+	// inflation schedule aims to have bonded, in basis points
+	DefaultTargetStakingRatio = 6700
+	// DefaultBlocksPerYear is the default number of blocks per year, at one
+	// block every five seconds
+	DefaultBlocksPerYear = 6311520
+)
+
+// Policy decides how many coins each block mints and how many fees are
+// burned. It is a consensus parameter: every node must use the same policy.
+type Policy struct {
+	Schedule           Schedule `json:"schedule"`
+	BlockReward        uint64   `json:"block_reward"`         // fixed reward, or the first reward of a halving schedule
+	HalvingInterval    uint64   `json:"halving_interval"`     // blocks between halvings
+	InflationMin       uint64   `json:"inflation_min"`        // yearly inflation at or above the target ratio, basis points
+	InflationMax       uint64   `json:"inflation_max"`        // yearly inflation with nothing bonded, basis points
+	TargetStakingRatio uint64   `json:"target_staking_ratio"` // basis points of the supply
+	BlocksPerYear      uint64   `json:"blocks_per_year"`      // converts yearly inflation to a block reward
+	FeeBurnShare       uint64   `json:"fee_burn_share"`       // basis points of each block's fees burned
+}
+
+// DefaultPolicy returns a fixed reward of DefaultBlockReward with no fee
+// burning; the other schedules' settings hold their defaults
+func DefaultPolicy() Policy {
+	return Policy{
+		Schedule:           Fixed,
+		BlockReward:        DefaultBlockReward,
+		HalvingInterval:    DefaultHalvingInterval,
+		InflationMin:       DefaultInflationMin,
+		InflationMax:       DefaultInflationMax,
+		TargetStakingRatio: DefaultTargetStakingRatio,
+		BlocksPerYear:      DefaultBlocksPerYear,
+	}
+}
+
+// Validate checks that the policy is usable
+func (p Policy) Validate() error {
+	switch p.Schedule {
+	case Fixed:
+	case Halving:
+		if p.HalvingInterval == 0 {
+			return fmt.Errorf("halving interval must be positive")
+		}
+	case Inflation:
+		if p.InflationMin > p.InflationMax {
+			return fmt.Errorf("minimum inflation %d exceeds maximum %d", p.InflationMin, p.InflationMax)
+		}
+		if p.TargetStakingRatio == 0 || p.TargetStakingRatio > BasisPoints {
+			return fmt.Errorf("target staking ratio must be between 1 and %d basis points", BasisPoints)
+		}
+		if p.BlocksPerYear == 0 {
+			return fmt.Errorf("blocks per year must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown reward schedule %q", p.Schedule)
+	}
+	if p.FeeBurnShare > BasisPoints {
+		return fmt.Errorf("fee burn share %d exceeds %d basis points", p.FeeBurnShare, BasisPoints)
+	}
+	return nil
+}
+
+// CalculateReward returns the reward minted by the block at height, given
+// the supply before the block
+func (p Policy) CalculateReward(height uint64, supply Supply) uint64 {
+	switch p.Schedule {
+	case Halving:
+		if height == 0 || p.HalvingInterval == 0 {
+			return p.BlockReward
+		}
+		halvings := (height - 1) / p.HalvingInterval
+		if halvings >= 64 {
+			return 0
+		}
+		return p.BlockReward >> halvings
+	case Inflation:
+		if p.BlocksPerYear == 0 {
+			return 0
+		}
+		return mulDiv(supply.Total(), p.InflationRate(supply), BasisPoints*p.BlocksPerYear)
+	default:
+		return p.BlockReward
+	}
+}
+
+// InflationRate returns the yearly inflation of the inflation schedule, in
+// basis points: InflationMax with nothing bonded, falling linearly to
+// InflationMin as the staking ratio reaches TargetStakingRatio
+func (p Policy) InflationRate(supply Supply) uint64 {
+	ratio := supply.StakingRatio()
+	if p.TargetStakingRatio == 0 || ratio >= p.TargetStakingRatio || p.InflationMax < p.InflationMin {
+		return p.InflationMin
+	}
+	return p.InflationMax - (p.InflationMax-p.InflationMin)*ratio/p.TargetStakingRatio
+}
+
+// BurnedFees returns the part of a block's fees that is burned rather than
+// paid to the validator
+func (p Policy) BurnedFees(fees uint64) uint64 {
+	return mulDiv(fees, min(p.FeeBurnShare, BasisPoints), BasisPoints)
+}
+
+// Supply tracks the coins in existence
+type Supply struct {
+	Minted    uint64 `json:"total_minted"` // coins created, at genesis and by block rewards
+	Burned    uint64 `json:"total_burned"` // coins destroyed by fee burning and slashing
+	Bonded    uint64 `json:"bonded"`       // coins staked or delegated
+	Unbonding uint64 `json:"unbonding"`    // coins waiting out the unbonding period
+	Locked    uint64 `json:"locked"`       // coins held in hash-time-locked contracts
+}
+
+// Total returns the coins in existence
+func (s Supply) Total() uint64 {
+	return s.Minted - s.Burned
+}
+
+// Circulating returns the coins that are neither bonded, unbonding nor
+// locked
+func (s Supply) Circulating() uint64 {
+	return s.Total() - s.Bonded - s.Unbonding - s.Locked
+}
+
+// StakingRatio returns the bonded share of the supply, in basis points
+func (s Supply) StakingRatio() uint64 {
+	if s.Total() == 0 {
+		return 0
+	}
+	return mulDiv(s.Bonded, BasisPoints, s.Total())
+}
+
+// mulDiv returns a*b/c without overflowing the intermediate product; the
+// result must fit in a uint64
+func mulDiv(a, b, c uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	quo, _ := bits.Div64(hi, lo, c)
+	return quo
+}
@@ -0,0 +1,22 @@
+package network
+
+import "github.com/aetheria/blockchain/pkg/events"
+
+// PeerConnectedEvent is published when a node adds a peer
+type PeerConnectedEvent struct {
+	NodeID  string `json:"node_id"`
+	PeerID  string `json:"peer_id"`
+	Address string `json:"address"`
+}
+
+// Topic returns events.TopicPeerConnected
+func (PeerConnectedEvent) Topic() events.Topic { return events.TopicPeerConnected }
+
+// PeerDisconnectedEvent is published when a node removes a peer
+type PeerDisconnectedEvent struct {
+	NodeID string `json:"node_id"`
+	PeerID string `json:"peer_id"`
+}
+
+// Topic returns events.TopicPeerDisconnected
+func (PeerDisconnectedEvent) Topic() events.Topic { return events.TopicPeerDisconnected }
@@ -2,6 +2,7 @@ package network
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -21,6 +22,8 @@ const (
 	MsgTypePong        MessageType = "pong"
 	MsgTypeGetBlocks   MessageType = "get_blocks"
 	MsgTypeBlocks      MessageType = "blocks"
+	MsgTypeEvidence    MessageType = "evidence"
+	MsgTypeVote        MessageType = "vote"
 )
 
 // Message represents a network message
@@ -33,16 +36,17 @@ type Message struct {
 
 // Node represents a blockchain node
 type Node struct {
-	ID           string
-	Address      string
-	Blockchain   *blockchain.Blockchain
-	Consensus    *consensus.PoS
-	Peers        map[string]*Peer
-	IsValidator  bool
-	Validator    *consensus.Validator
-	mu           sync.RWMutex
-	stopChan     chan struct{}
-	messageChan  chan *Message
+	ID          string
+	Address     string
+	Blockchain  *blockchain.Blockchain
+	Consensus   *consensus.PoS
+	Finality    *consensus.BFT
+	Peers       map[string]*Peer
+	IsValidator bool
+	Validator   *consensus.Validator
+	mu          sync.RWMutex
+	stopChan    chan struct{}
+	messageChan chan *Message
 }
 
 // NewNode creates a new node
@@ -52,6 +56,7 @@ func NewNode(id, address string, bc *blockchain.Blockchain, pos *consensus.PoS)
 		Address:     address,
 		Blockchain:  bc,
 		Consensus:   pos,
+		Finality:    consensus.NewBFT(bc.ChainID(), pos.BlockTime, bc),
 		Peers:       make(map[string]*Peer),
 		IsValidator: false,
 		stopChan:    make(chan struct{}),
@@ -59,17 +64,21 @@ func NewNode(id, address string, bc *blockchain.Blockchain, pos *consensus.PoS)
 	}
 }
 
-// SetValidator sets this node as a validator
+// SetValidator sets this node as a validator. The validator must already
+// be in the active set of the current epoch, which a new staker joins at
+// the next epoch start.
 func (n *Node) SetValidator(validator *consensus.Validator) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	if err := n.Consensus.RegisterValidator(validator); err != nil {
-		return fmt.Errorf("failed to register validator: %w", err)
+	n.Consensus.SyncValidators(n.Blockchain.HeadState())
+	if _, err := n.Consensus.Validators().GetValidator(validator.Address); err != nil {
+		return fmt.Errorf("validator %s is not in the active validator set", validator.Address)
 	}
 
 	n.IsValidator = true
 	n.Validator = validator
+	n.Finality.SetSigner(validator)
 	return nil
 }
 
@@ -77,6 +86,9 @@ func (n *Node) SetValidator(validator *consensus.Validator) error {
 func (n *Node) Start() error {
 	log.Printf("Starting node %s at %s", n.ID, n.Address)
 
+	// Derive validators from the on-chain stakes
+	n.Consensus.SyncValidators(n.Blockchain.HeadState())
+
 	// Start message processing
 	go n.processMessages()
 
@@ -125,6 +137,22 @@ func (n *Node) handleMessage(msg *Message) {
 		}
 		n.handleTransaction(&tx)
 
+	case MsgTypeEvidence:
+		var ev blockchain.Evidence
+		if err := json.Unmarshal(msg.Data, &ev); err != nil {
+			log.Printf("Failed to unmarshal evidence: %v", err)
+			return
+		}
+		n.handleEvidence(&ev)
+
+	case MsgTypeVote:
+		var vote blockchain.Vote
+		if err := json.Unmarshal(msg.Data, &vote); err != nil {
+			log.Printf("Failed to unmarshal vote: %v", err)
+			return
+		}
+		n.handleVote(&vote)
+
 	case MsgTypePing:
 		n.handlePing(msg.From)
 
@@ -137,23 +165,35 @@ func (n *Node) handleMessage(msg *Message) {
 func (n *Node) handleBlock(block *blockchain.Block) {
 	log.Printf("Node %s received block %d from validator %s", n.ID, block.Index, block.Validator)
 
-	// Validate block
-	prevBlock := n.Blockchain.GetLatestBlock()
+	// Validate block against its parent, which may be on a side branch
+	prevBlock := n.Blockchain.GetKnownBlock(block.PrevHash)
+	if prevBlock == nil {
+		log.Printf("Unknown parent for block %d: %s", block.Index, block.PrevHash)
+		return
+	}
 	if err := n.Consensus.ValidateBlock(block, prevBlock); err != nil {
 		log.Printf("Invalid block: %v", err)
 		return
 	}
 
-	// Add block to blockchain
+	// Add block to blockchain, which checks it was signed by its slot leader
 	if err := n.Blockchain.AddBlock(block); err != nil {
 		log.Printf("Failed to add block: %v", err)
 		return
 	}
 
+	// A validly signed block conflicting with a known one is a double-sign
+	if ev := n.Blockchain.DetectDoubleSign(block); ev != nil {
+		log.Printf("Validator %s double-signed at height %d", block.Validator, block.Index)
+		n.handleEvidence(ev)
+	}
+
 	log.Printf("Block %d added to chain", block.Index)
+	n.Consensus.SyncValidators(n.Blockchain.HeadState())
 
 	// Broadcast to peers
 	n.BroadcastBlock(block)
+	n.voteOnHead()
 }
 
 // handleTransaction handles a received transaction
@@ -170,6 +210,58 @@ func (n *Node) handleTransaction(tx *blockchain.Transaction) {
 	n.BroadcastTransaction(tx)
 }
 
+// handleEvidence handles double-sign evidence, either received from a peer
+// or detected locally
+func (n *Node) handleEvidence(ev *blockchain.Evidence) {
+	if err := n.Blockchain.AddEvidence(ev); err != nil {
+		log.Printf("Rejected evidence against %s: %v", ev.Validator(), err)
+		return
+	}
+
+	log.Printf("Evidence %s against validator %s added to pool", ev.ID(), ev.Validator())
+	n.BroadcastEvidence(ev)
+}
+
+// handleVote handles a received prevote or precommit, relaying it to peers
+// once counted
+func (n *Node) handleVote(vote *blockchain.Vote) {
+	votes, commit, err := n.Finality.AddVote(vote)
+	if errors.Is(err, consensus.ErrKnownVote) {
+		return
+	}
+	if err != nil {
+		log.Printf("Rejected %s by %s at height %d: %v", vote.Type, vote.Validator, vote.Height, err)
+		return
+	}
+
+	n.BroadcastVote(vote)
+	n.castVotes(votes, commit)
+}
+
+// voteOnHead starts finalizing the head block unless it is already final
+func (n *Node) voteOnHead() {
+	n.Finality.Finalized(n.Blockchain.GetBlock(n.Blockchain.FinalizedHeight()))
+	head := n.Blockchain.GetLatestBlock()
+	if n.Blockchain.IsFinal(head.Index) {
+		return
+	}
+	n.castVotes(n.Finality.Propose(head, n.Consensus.Validators()))
+}
+
+// castVotes broadcasts this node's votes and adds the commit, if any, to
+// the chain
+func (n *Node) castVotes(votes []*blockchain.Vote, commit *blockchain.Commit) {
+	for _, vote := range votes {
+		n.BroadcastVote(vote)
+	}
+	if commit == nil {
+		return
+	}
+	if err := n.Blockchain.AddCommit(commit); err != nil {
+		log.Printf("Failed to add commit for block %d: %v", commit.Height, err)
+	}
+}
+
 // handlePing handles a ping message
 func (n *Node) handlePing(from string) {
 	// Send pong response
@@ -184,7 +276,7 @@ func (n *Node) handlePing(from string) {
 // handleGetBlocks handles a request for blocks
 func (n *Node) handleGetBlocks(from string) {
 	// Send all blocks
-	blocks := n.Blockchain.Blocks
+	blocks := n.Blockchain.BlocksRange(0, 0)
 	data, _ := json.Marshal(blocks)
 	msg := &Message{
 		Type:      MsgTypeBlocks,
@@ -206,10 +298,19 @@ func (n *Node) produceBlocks() {
 			return
 		case <-ticker.C:
 			n.tryProduceBlock()
+			n.checkRoundTimeout()
 		}
 	}
 }
 
+// checkRoundTimeout moves finality to the next round when the current one
+// has stalled, voting again on the canonical block at its height
+func (n *Node) checkRoundTimeout() {
+	height, _, _ := n.Finality.Status()
+	votes := n.Finality.Timeout(time.Now(), n.Blockchain.GetBlock(height))
+	n.castVotes(votes, nil)
+}
+
 // tryProduceBlock attempts to produce a new block
 func (n *Node) tryProduceBlock() {
 	if !n.IsValidator {
@@ -217,14 +318,16 @@ func (n *Node) tryProduceBlock() {
 	}
 
 	latestBlock := n.Blockchain.GetLatestBlock()
-	
-	// Check if it's time to create a block
-	if !n.Consensus.ShouldCreateBlock(latestBlock.Timestamp) {
+
+	// Check if the current slot is still free on top of the head
+	genesis := n.Blockchain.Genesis
+	slot := genesis.Params.Slot(genesis.GenesisTime, time.Now().Unix())
+	if slot <= genesis.Params.Slot(genesis.GenesisTime, latestBlock.Timestamp) {
 		return
 	}
 
 	// Select validator for this slot
-	selectedValidator, err := n.Consensus.SelectValidator(latestBlock.Hash, time.Now().Unix())
+	selectedValidator, err := n.Consensus.SelectValidator(n.Blockchain.HeadState(), slot)
 	if err != nil {
 		log.Printf("Failed to select validator: %v", err)
 		return
@@ -235,10 +338,10 @@ func (n *Node) tryProduceBlock() {
 		return
 	}
 
-	log.Printf("Node %s selected to produce block", n.ID)
+	log.Printf("Node %s selected to produce the block of slot %d", n.ID, slot)
 
 	// Create block
-	block := n.Blockchain.CreateBlock(n.Validator.Address)
+	block := n.Blockchain.CreateBlock(n.Validator.Address, slot, n.Validator.PrivateKey)
 
 	// Sign block
 	if err := block.Sign(n.Validator.PrivateKey); err != nil {
@@ -253,9 +356,11 @@ func (n *Node) tryProduceBlock() {
 	}
 
 	log.Printf("Block %d produced by validator %s", block.Index, n.Validator.Address)
+	n.Consensus.SyncValidators(n.Blockchain.HeadState())
 
 	// Broadcast block
 	n.BroadcastBlock(block)
+	n.voteOnHead()
 }
 
 // BroadcastBlock broadcasts a block to all peers
@@ -294,6 +399,42 @@ func (n *Node) BroadcastTransaction(tx *blockchain.Transaction) {
 	}
 }
 
+// BroadcastEvidence broadcasts double-sign evidence to all peers
+func (n *Node) BroadcastEvidence(ev *blockchain.Evidence) {
+	data, _ := json.Marshal(ev)
+	msg := &Message{
+		Type:      MsgTypeEvidence,
+		Data:      data,
+		From:      n.ID,
+		Timestamp: time.Now().Unix(),
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, peer := range n.Peers {
+		n.sendMessage(peer.ID, msg)
+	}
+}
+
+// BroadcastVote broadcasts a prevote or precommit to all peers
+func (n *Node) BroadcastVote(vote *blockchain.Vote) {
+	data, _ := json.Marshal(vote)
+	msg := &Message{
+		Type:      MsgTypeVote,
+		Data:      data,
+		From:      n.ID,
+		Timestamp: time.Now().Unix(),
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for _, peer := range n.Peers {
+		n.sendMessage(peer.ID, msg)
+	}
+}
+
 // sendMessage sends a message to a peer
 func (n *Node) sendMessage(peerID string, msg *Message) {
 	n.mu.RLock()
@@ -307,20 +448,27 @@ func (n *Node) sendMessage(peerID string, msg *Message) {
 	peer.SendMessage(msg)
 }
 
-// AddPeer adds a peer to the node
+// AddPeer adds a peer to the node and publishes a PeerConnectedEvent on the
+// blockchain's event bus
 func (n *Node) AddPeer(peer *Peer) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	n.Peers[peer.ID] = peer
 	log.Printf("Node %s added peer %s", n.ID, peer.ID)
+	n.Blockchain.Events().Publish(PeerConnectedEvent{NodeID: n.ID, PeerID: peer.ID, Address: peer.Address})
 }
 
-// RemovePeer removes a peer from the node
+// RemovePeer removes a peer from the node and publishes a
+// PeerDisconnectedEvent on the blockchain's event bus
 func (n *Node) RemovePeer(peerID string) {
 	n.mu.Lock()
 	defer n.mu.Unlock()
+	if _, exists := n.Peers[peerID]; !exists {
+		return
+	}
 	delete(n.Peers, peerID)
 	log.Printf("Node %s removed peer %s", n.ID, peerID)
+	n.Blockchain.Events().Publish(PeerDisconnectedEvent{NodeID: n.ID, PeerID: peerID})
 }
 
 // ReceiveMessage receives a message from the network
@@ -9,6 +9,7 @@ PORT=8080
 NODE_ID="node1"
 VALIDATOR=false
 WALLET=""
+GENESIS="genesis.json"
 
 # Parse arguments
 while [[ $# -gt 0 ]]; do
@@ -29,6 +30,10 @@ while [[ $# -gt 0 ]]; do
       WALLET="$2"
       shift 2
       ;;
+    --genesis)
+      GENESIS="$2"
+      shift 2
+      ;;
     *)
       echo "Unknown option: $1"
       exit 1
@@ -40,6 +45,11 @@ done
 echo "Building Aetheria blockchain..."
 go build -o aetheria ./cmd/aetheria
 
+if [ ! -f "$GENESIS" ]; then
+  echo "Error: genesis file $GENESIS not found (create one with ./aetheria genesis init)"
+  exit 1
+fi
+
 # Start the node
 echo "Starting node $NODE_ID on port $PORT..."
 
@@ -48,7 +58,7 @@ if [ "$VALIDATOR" = true ]; then
     echo "Error: Validator mode requires --wallet flag"
     exit 1
   fi
-  ./aetheria --port=$PORT --node-id=$NODE_ID --validator --wallet=$WALLET
+  ./aetheria --port=$PORT --node-id=$NODE_ID --genesis=$GENESIS --validator --wallet=$WALLET
 else
-  ./aetheria --port=$PORT --node-id=$NODE_ID
+  ./aetheria --port=$PORT --node-id=$NODE_ID --genesis=$GENESIS
 fi